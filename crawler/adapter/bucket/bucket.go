@@ -2,32 +2,178 @@ package bucket
 
 import (
 	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+var ErrNotFound = errors.New("object not found")
+
 type Bucket interface {
 	Put(key string, body []byte) error
+	Get(key string) ([]byte, error)
+	Exists(key string) (bool, error)
+	Delete(key string) error
+	List(prefix string, fn func(key string) error) error
+	Stat(key string) (*Info, error)
+}
+
+type Info struct {
+	Key      string
+	Size     int64
+	Modified time.Time
 }
 
-type bucket struct {
-	path string
+const tmpPrefix = ".tmp-"
+
+type local struct {
+	path  string
+	fsync bool
 }
 
-func New(path string) (*bucket, error) {
+func NewLocal(path string, fsync bool) (*local, error) {
 	if len(path) < 1 {
 		return nil, errors.New("path can't be empty")
 	}
 	if path[len(path)-1:] == "/" {
 		path = path[:len(path)-1]
 	}
-	return &bucket{path: path}, nil
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	return &local{path: path, fsync: fsync}, nil
+}
+
+func (b *local) file(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if len(key) < 1 || clean == "/" {
+		return "", errors.New("invalid key")
+	}
+	return b.path + filepath.FromSlash(clean), nil
+}
+
+func (b *local) Put(key string, body []byte) error {
+	name, err := b.file(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// write to a temp file first, readers never see half written objects
+	tmp, err := os.CreateTemp(dir, tmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if b.fsync {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+
+	if b.fsync {
+		d, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		return d.Sync()
+	}
+	return nil
+}
+
+func (b *local) Get(key string) ([]byte, error) {
+	name, err := b.file(key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return body, err
+}
+
+func (b *local) Exists(key string) (bool, error) {
+	_, err := b.Stat(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
 }
 
-func (b *bucket) Put(key string, body []byte) error {
-	dir := filepath.Dir(key)
-	if err := os.MkdirAll(b.path+"/"+dir, 0777); err != nil {
+func (b *local) Delete(key string) error {
+	name, err := b.file(key)
+	if err != nil {
 		return err
 	}
-	return os.WriteFile(b.path+"/"+key, body, 0777)
+	err = os.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (b *local) List(prefix string, fn func(key string) error) error {
+	// only walk the directory the prefix points into
+	root := b.path
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = b.path + "/" + prefix[:i]
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tmpPrefix) {
+			return nil
+		}
+		key := filepath.ToSlash(path[len(b.path)+1:])
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (b *local) Stat(key string) (*Info, error) {
+	name, err := b.file(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, ErrNotFound
+	}
+	return &Info{Key: key, Size: stat.Size(), Modified: stat.ModTime()}, nil
 }
@@ -0,0 +1,87 @@
+package bucket_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket/buckettest"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	b, err := bucket.NewLocal(dir+"/", true)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	buckettest.Run(t, b)
+
+	stat, err := os.Stat(dir + "/ab/cd/weoifjwef")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if stat.Mode().Perm() != 0644 {
+		t.Errorf("got mode: %o, want: 644", stat.Mode().Perm())
+	}
+
+	if err := b.Put("../outside", []byte("x")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := os.Stat(dir + "/outside"); err != nil {
+		t.Errorf("key escaped the bucket: %s", err.Error())
+	}
+}
+
+func TestSharded(t *testing.T) {
+	raw, err := bucket.NewLocal(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b := bucket.NewSharded(raw)
+	buckettest.Run(t, b)
+
+	// objects written before sharding are still found under their new key
+	legacy := "0a1b2c3d4e5f"
+	if err := raw.Put(legacy, []byte("old")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := b.Put("9f8e7d6c5b4a.png", []byte("new")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := raw.Stat("9f/8e/9f8e7d6c5b4a.png"); err != nil {
+		t.Errorf("object not stored sharded: %s", err.Error())
+	}
+	got, err := b.Get(legacy + ".jpeg")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(got) != "old" {
+		t.Errorf("got body: '%s', want: 'old'", string(got))
+	}
+
+	for _, prefix := range []string{"", "9f8e", "0a1b"} {
+		keys := map[string]bool{}
+		err := b.List(prefix, func(key string) error {
+			keys[key] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if (prefix != "0a1b") != keys["9f8e7d6c5b4a.png"] || (prefix != "9f8e") != keys[legacy] {
+			t.Errorf("unexpected keys for prefix '%s': %v", prefix, keys)
+		}
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := httptest.NewServer(bucket.NewFakeS3("images"))
+	defer srv.Close()
+
+	b, err := bucket.NewS3(srv.URL, "", "images", "access", "secret")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	buckettest.Run(t, b)
+}
@@ -0,0 +1,80 @@
+package buckettest
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+)
+
+// Run checks that b behaves like every other bucket. It writes keys at the
+// top level and below "ab/", so b should be empty.
+func Run(t *testing.T, b bucket.Bucket) {
+	input := map[string][]byte{
+		"fkdsjfwefw":       []byte("dlfkjsdf"),
+		"ab/cd/weoifjwef":  []byte("weoifjweofjwe"),
+		"ab/ce/woeifjwoef": []byte("wefowefjwoe"),
+		"empty":            {},
+	}
+
+	for k, v := range input {
+		if err := b.Put(k, v); err != nil {
+			t.Error(err.Error())
+			return
+		}
+	}
+
+	for k, v := range input {
+		got, err := b.Get(k)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !bytes.Equal(got, v) {
+			t.Errorf("got body: '%s', want: '%s'", string(got), string(v))
+		}
+
+		info, err := b.Stat(k)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if info.Size != int64(len(v)) {
+			t.Errorf("got size: %d, want: %d", info.Size, len(v))
+		}
+	}
+
+	keys := []string{}
+	err := b.List("ab/", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "ab/cd/weoifjwef" || keys[1] != "ab/ce/woeifjwoef" {
+		t.Errorf("unexpected keys for prefix: %v", keys)
+	}
+
+	if err := b.Delete("fkdsjfwefw"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	exist, err := b.Exists("fkdsjfwefw")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if exist {
+		t.Error("deleted key still exists")
+	}
+	if _, err := b.Get("fkdsjfwefw"); err != bucket.ErrNotFound {
+		t.Errorf("got error: %v, want: %v", err, bucket.ErrNotFound)
+	}
+	if err := b.Delete("fkdsjfwefw"); err != nil {
+		t.Errorf("deleting a missing key failed: %s", err.Error())
+	}
+}
@@ -0,0 +1,7 @@
+package bucket
+
+import "net/http"
+
+func NewFakeS3(name string) http.Handler {
+	return &fakeS3{bucket: name, objects: map[string][]byte{}}
+}
@@ -0,0 +1,60 @@
+package bucket
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
+)
+
+// measured records the latency and errors of the wrapped bucket. A missing
+// object isn't counted as an error.
+type measured struct {
+	Bucket
+}
+
+func NewMeasured(b Bucket) *measured {
+	return &measured{Bucket: b}
+}
+
+func measure(op string, start time.Time, err error) {
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	metrics.Measure("bucket", op, start, err)
+}
+
+func (b *measured) Put(key string, body []byte) error {
+	start := time.Now()
+	err := b.Bucket.Put(key, body)
+	measure("put", start, err)
+	return err
+}
+
+func (b *measured) Get(key string) ([]byte, error) {
+	start := time.Now()
+	body, err := b.Bucket.Get(key)
+	measure("get", start, err)
+	return body, err
+}
+
+func (b *measured) Exists(key string) (bool, error) {
+	start := time.Now()
+	exist, err := b.Bucket.Exists(key)
+	measure("exists", start, err)
+	return exist, err
+}
+
+func (b *measured) Delete(key string) error {
+	start := time.Now()
+	err := b.Bucket.Delete(key)
+	measure("delete", start, err)
+	return err
+}
+
+func (b *measured) Stat(key string) (*Info, error) {
+	start := time.Now()
+	info, err := b.Bucket.Stat(key)
+	measure("stat", start, err)
+	return info, err
+}
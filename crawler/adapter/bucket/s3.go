@@ -0,0 +1,277 @@
+package bucket
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	gourl "net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3 talks to any S3 compatible API (AWS, MinIO, Ceph, ...) using path style
+// addressing and signature version 4.
+type s3 struct {
+	client   *http.Client
+	endpoint *gourl.URL
+	region   string
+	name     string
+	access   string
+	secret   string
+}
+
+func NewS3(endpoint, region, name, access, secret string) (*s3, error) {
+	if len(name) < 1 {
+		return nil, errors.New("bucket name can't be empty")
+	}
+	url, err := gourl.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if len(url.Scheme) < 1 || len(url.Host) < 1 {
+		return nil, fmt.Errorf("invalid endpoint: '%s'", endpoint)
+	}
+	if len(region) < 1 {
+		region = "us-east-1"
+	}
+	return &s3{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		endpoint: url,
+		region:   region,
+		name:     name,
+		access:   access,
+		secret:   secret,
+	}, nil
+}
+
+func (b *s3) do(method, key string, query gourl.Values, body []byte) (*http.Response, error) {
+	url := *b.endpoint
+	url.Path = url.Path + "/" + b.name
+	if len(key) > 0 {
+		url.Path = url.Path + "/" + key
+	}
+	url.RawPath = uriEncode(url.Path, false)
+	url.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, url.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hash := emptyHash
+	if body != nil {
+		sum := sha256.Sum256(body)
+		hash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("x-amz-content-sha256", hash)
+	req.Header.Set("x-amz-date", time.Now().UTC().Format("20060102T150405Z"))
+	b.sign(req, hash)
+
+	return b.client.Do(req)
+}
+
+func (b *s3) sign(req *http.Request, payload string) {
+	date := req.Header.Get("x-amz-date")
+	scope := date[:8] + "/" + b.region + "/s3/aws4_request"
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonHeaders := ""
+	for _, k := range names {
+		canonHeaders += k + ":" + headers[k] + "\n"
+	}
+	signed := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	canon := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		strings.Join(params, "&"),
+		canonHeaders,
+		signed,
+		payload,
+	}, "\n")
+	sum := sha256.Sum256([]byte(canon))
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + b.secret)
+	for _, part := range []string{date[:8], b.region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.access,
+		scope,
+		signed,
+		hex.EncodeToString(hmacSha256(key, toSign)),
+	))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode escapes everything but the unreserved characters, the way
+// signature version 4 expects it.
+func uriEncode(s string, slash bool) string {
+	sb := &strings.Builder{}
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !slash) {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+func responseError(res *http.Response) error {
+	b, _ := io.ReadAll(res.Body)
+	return fmt.Errorf("response status: '%d', with body: '%s'", res.StatusCode, string(b))
+}
+
+func (b *s3) Put(key string, body []byte) error {
+	if body == nil {
+		body = []byte{}
+	}
+	res, err := b.do(http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return responseError(res)
+	}
+	return nil
+}
+
+func (b *s3) Get(key string) ([]byte, error) {
+	res, err := b.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode > 299 {
+		return nil, responseError(res)
+	}
+	return io.ReadAll(res.Body)
+}
+
+func (b *s3) Exists(key string) (bool, error) {
+	_, err := b.Stat(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *s3) Delete(key string) error {
+	res, err := b.do(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 && res.StatusCode != http.StatusNotFound {
+		return responseError(res)
+	}
+	return nil
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated bool   `xml:"IsTruncated"`
+	NextToken   string `xml:"NextContinuationToken"`
+}
+
+func (b *s3) List(prefix string, fn func(key string) error) error {
+	token := ""
+	for {
+		query := gourl.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if len(token) > 0 {
+			query.Set("continuation-token", token)
+		}
+		res, err := b.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode > 299 {
+			err := responseError(res)
+			res.Body.Close()
+			return err
+		}
+		list := &listResult{}
+		err = xml.NewDecoder(res.Body).Decode(list)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range list.Contents {
+			if err := fn(obj.Key); err != nil {
+				return err
+			}
+		}
+		if !list.IsTruncated || len(list.NextToken) < 1 {
+			return nil
+		}
+		token = list.NextToken
+	}
+}
+
+func (b *s3) Stat(key string) (*Info, error) {
+	res, err := b.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode > 299 {
+		return nil, fmt.Errorf("response status: '%d'", res.StatusCode)
+	}
+
+	mod, err := http.ParseTime(res.Header.Get("Last-Modified"))
+	if err != nil {
+		return nil, err
+	}
+	return &Info{Key: key, Size: res.ContentLength, Modified: mod}, nil
+}
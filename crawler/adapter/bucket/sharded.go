@@ -0,0 +1,110 @@
+package bucket
+
+import (
+	"path"
+	"strings"
+)
+
+// sharded stores flat keys like "abcdef....jpeg" as "ab/cd/abcdef....jpeg",
+// so no directory ends up with millions of entries. Lookups fall back to the
+// old flat layout, where objects were stored under their bare hash, until
+// every object has been migrated.
+type sharded struct {
+	Bucket
+}
+
+func NewSharded(b Bucket) *sharded {
+	return &sharded{Bucket: b}
+}
+
+// ShardKey returns where key lives in the sharded layout. Keys that already
+// contain a directory or are too short to shard are used as they are.
+func ShardKey(key string) string {
+	if len(key) < 5 || strings.Contains(key, "/") {
+		return key
+	}
+	return key[:2] + "/" + key[2:4] + "/" + key
+}
+
+// FlatKey returns where key lived before sharding, the bare hash.
+func FlatKey(key string) string {
+	if strings.Contains(key, "/") {
+		return key
+	}
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+func (b *sharded) Put(key string, body []byte) error {
+	return b.Bucket.Put(ShardKey(key), body)
+}
+
+func (b *sharded) Get(key string) ([]byte, error) {
+	body, err := b.Bucket.Get(ShardKey(key))
+	if err == ErrNotFound && FlatKey(key) != ShardKey(key) {
+		return b.Bucket.Get(FlatKey(key))
+	}
+	return body, err
+}
+
+func (b *sharded) Exists(key string) (bool, error) {
+	_, err := b.Stat(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *sharded) Delete(key string) error {
+	if err := b.Bucket.Delete(ShardKey(key)); err != nil {
+		return err
+	}
+	if FlatKey(key) != ShardKey(key) {
+		return b.Bucket.Delete(FlatKey(key))
+	}
+	return nil
+}
+
+// List reports sharded objects under their flat key and objects of the old
+// layout under their bare hash.
+func (b *sharded) List(prefix string, fn func(key string) error) error {
+	if strings.Contains(prefix, "/") {
+		return b.Bucket.List(prefix, fn)
+	}
+	if len(prefix) >= 4 {
+		err := b.Bucket.List(prefix[:2]+"/"+prefix[2:4]+"/"+prefix, func(key string) error {
+			return fn(path.Base(key))
+		})
+		if err != nil {
+			return err
+		}
+		return b.Bucket.List(prefix, func(key string) error {
+			if strings.Contains(key, "/") {
+				return nil
+			}
+			return fn(key)
+		})
+	}
+
+	return b.Bucket.List("", func(key string) error {
+		parts := strings.Split(key, "/")
+		if len(parts) == 3 && ShardKey(parts[2]) == key {
+			key = parts[2]
+		}
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key)
+	})
+}
+
+func (b *sharded) Stat(key string) (*Info, error) {
+	info, err := b.Bucket.Stat(ShardKey(key))
+	if err == ErrNotFound && FlatKey(key) != ShardKey(key) {
+		info, err = b.Bucket.Stat(FlatKey(key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.Key = key
+	return info, nil
+}
@@ -3,12 +3,14 @@ package cache
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type Cache interface {
 	Close() error
+	Ping() error
 	Exist(hash string) (bool, error)
 	Set(hash string) error
 }
@@ -17,12 +19,19 @@ type cache struct {
 	client *redis.Client
 }
 
+// New connects to redis. The client dials again for whatever command finds
+// its connection gone and retries it with backoff, so a restarted redis only
+// fails the commands sent while it is down.
 func New(host, port, pass string) (*cache, error) {
 	cache := &cache{
 		client: redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%s", host, port),
-			Password: pass,
-			DB:       0,
+			Addr:            fmt.Sprintf("%s:%s", host, port),
+			Password:        pass,
+			DB:              0,
+			DialTimeout:     5 * time.Second,
+			MaxRetries:      5,
+			MinRetryBackoff: 100 * time.Millisecond,
+			MaxRetryBackoff: 2 * time.Second,
 		}),
 	}
 
@@ -38,6 +47,10 @@ func (c *cache) Close() error {
 	return c.client.Close()
 }
 
+func (c *cache) Ping() error {
+	return c.client.Ping(context.Background()).Err()
+}
+
 func (c *cache) Exist(hash string) (bool, error) {
 	_, err := c.client.Get(
 		context.Background(),
@@ -5,11 +5,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/faultproxy"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 )
 
-var c *cache
+var (
+	c    *cache
+	host string
+)
 
 func TestMain(m *testing.M) {
 	// uses a sensible default on windows (tcp/http) and linux/osx (socket)
@@ -41,9 +45,10 @@ func TestMain(m *testing.M) {
 
 	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
 	pool.MaxWait = 120 * time.Second
+	host = resource.Container.NetworkSettings.IPAddress
 	if err = pool.Retry(func() error {
 		c, err = New(
-			resource.Container.NetworkSettings.IPAddress,
+			host,
 			"6379",
 			"",
 		)
@@ -94,3 +99,38 @@ func TestExist(t *testing.T) {
 		}
 	}
 }
+
+func TestReconnect(t *testing.T) {
+	proxy, err := faultproxy.New(host + ":6379")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer proxy.Close()
+	proxyHost, proxyPort := proxy.HostPort()
+	flaky, err := New(proxyHost, proxyPort, "")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer flaky.Close()
+
+	proxy.Cut()
+	if _, err := flaky.Exist("wefjwoeif"); err == nil {
+		t.Error("no error while redis was unreachable")
+	}
+	proxy.Restore()
+
+	if err := flaky.Set("wefjwoeif"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	exist, err := flaky.Exist("wefjwoeif")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !exist {
+		t.Error("cache miss key: wefjwoeif")
+	}
+}
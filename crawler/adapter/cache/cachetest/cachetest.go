@@ -0,0 +1,53 @@
+package cachetest
+
+import (
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache"
+)
+
+// Run checks that c behaves like every other cache.
+func Run(t *testing.T, c cache.Cache) {
+	if err := c.Ping(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	input := []string{
+		"cwoeifjwoefj",
+		"cvoweijvwoev",
+		"cslkdfjsldkf",
+	}
+
+	for _, v := range input {
+		exist, err := c.Exist(v)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if exist {
+			t.Errorf("cache hit before set for key: %s", v)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		// setting a key twice is fine
+		for _, v := range input {
+			if err := c.Set(v); err != nil {
+				t.Error(err.Error())
+				return
+			}
+		}
+	}
+
+	for _, v := range input {
+		exist, err := c.Exist(v)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !exist {
+			t.Errorf("cache miss key: %s", v)
+		}
+	}
+}
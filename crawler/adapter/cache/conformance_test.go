@@ -0,0 +1,12 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache/cachetest"
+)
+
+func TestConformance(t *testing.T) {
+	cachetest.Run(t, cache.Live())
+}
@@ -0,0 +1,6 @@
+package cache
+
+// Live returns the cache connected to the test container.
+func Live() Cache {
+	return c
+}
@@ -0,0 +1,28 @@
+package cache
+
+import "github.com/kfc-manager/vision-seeker/crawler/domain/bloom"
+
+// filtered answers for keys the local Bloom filter has never seen without
+// asking the wrapped cache. The filter may lag behind the cache, keys set by
+// other crawlers or since the last snapshot then read as missing, which only
+// costs the caller the round trip the cache would have saved.
+type filtered struct {
+	Cache
+	filter *bloom.Filter
+}
+
+func NewFiltered(c Cache, f *bloom.Filter) *filtered {
+	return &filtered{Cache: c, filter: f}
+}
+
+func (c *filtered) Exist(hash string) (bool, error) {
+	if !c.filter.Test(hash) {
+		return false, nil
+	}
+	return c.Cache.Exist(hash)
+}
+
+func (c *filtered) Set(hash string) error {
+	c.filter.Add(hash)
+	return c.Cache.Set(hash)
+}
@@ -0,0 +1,27 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache/cachetest"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/memory"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/bloom"
+)
+
+func TestFiltered(t *testing.T) {
+	cachetest.Run(t, cache.NewFiltered(memory.NewCache(), bloom.New(100, 0.01)))
+
+	// a key the filter hasn't seen is missing, even if the cache has it
+	inner := memory.NewCache()
+	if err := inner.Set("wefoijwefoij"); err != nil {
+		t.Fatal(err.Error())
+	}
+	exist, err := cache.NewFiltered(inner, bloom.New(100, 0.01)).Exist("wefoijwefoij")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if exist {
+		t.Error("filter didn't answer for an unseen key")
+	}
+}
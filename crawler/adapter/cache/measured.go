@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
+)
+
+// measured records the latency and errors of the wrapped cache.
+type measured struct {
+	Cache
+}
+
+func NewMeasured(c Cache) *measured {
+	return &measured{Cache: c}
+}
+
+func (c *measured) Exist(hash string) (bool, error) {
+	start := time.Now()
+	exist, err := c.Cache.Exist(hash)
+	metrics.Measure("cache", "exist", start, err)
+	return exist, err
+}
+
+func (c *measured) Set(hash string) error {
+	start := time.Now()
+	err := c.Cache.Set(hash)
+	metrics.Measure("cache", "set", start, err)
+	return err
+}
@@ -1,11 +1,18 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
 	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ResType string
@@ -17,12 +24,30 @@ const (
 )
 
 type response struct {
-	Type ResType
-	Body []byte
+	Status       int
+	Type         ResType
+	Body         []byte
+	NotModified  bool // the server answered 304, Body is empty
+	ETag         string
+	LastModified string
+}
+
+// StatusError is the error for a response that is neither successful nor
+// not modified.
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response status: '%d', with body: '%s'", e.Status, e.Body)
 }
 
 type Client interface {
-	Get(url string) (*response, error)
+	Get(ctx context.Context, url string) (*response, error)
+	// GetIfChanged only transfers the body if the resource changed since
+	// the response that had etag and lastModified, either may be empty.
+	GetIfChanged(ctx context.Context, url, etag, lastModified string) (*response, error)
 }
 
 type client struct {
@@ -35,24 +60,74 @@ func New() *client {
 	}}
 }
 
-func (c *client) Get(url string) (*response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *client) Get(ctx context.Context, url string) (*response, error) {
+	return c.GetIfChanged(ctx, url, "", "")
+}
+
+// GetIfChanged traces the request with a span for each of its phases, like
+// the DNS lookup and the download of the body. No trace context is sent
+// along, the servers are none of ours.
+func (c *client) GetIfChanged(
+	ctx context.Context,
+	url, etag, lastModified string,
+) (_ *response, err error) {
+	ctx, span := tracing.Start(ctx, "client.get")
+	span.SetAttributes(attribute.String("url.full", url))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = httptrace.WithClientTrace(ctx, otelhttptrace.NewClientTrace(ctx))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if len(lastModified) > 0 {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	start, status := time.Now(), 0
+	done := metrics.Request(req.URL.Hostname())
+	defer func() {
+		done()
+		metrics.FetchDuration.WithLabelValues(metrics.StatusClass(status)).
+			Observe(time.Since(start).Seconds())
+	}()
 
 	res, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
+	status = res.StatusCode
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+
+	if res.StatusCode == http.StatusNotModified {
+		// servers may send fresher validators along
+		if h := res.Header.Get("ETag"); len(h) > 0 {
+			etag = h
+		}
+		if h := res.Header.Get("Last-Modified"); len(h) > 0 {
+			lastModified = h
+		}
+		return &response{
+			Status:       res.StatusCode,
+			NotModified:  true,
+			ETag:         etag,
+			LastModified: lastModified,
+		}, nil
+	}
 
-	b, err := io.ReadAll(res.Body)
+	b, err := tracing.Do(ctx, "client.read_body", func() ([]byte, error) {
+		return io.ReadAll(res.Body)
+	})
+	metrics.BytesDownloaded.Add(float64(len(b)))
 	if err != nil {
 		return nil, err
 	}
 	if res.StatusCode > 299 || res.StatusCode < 200 {
-		return nil, fmt.Errorf("response status: '%d', with body: '%s'", res.StatusCode, string(b))
+		return nil, &StatusError{Status: res.StatusCode, Body: string(b)}
 	}
 
 	t := Unkown
@@ -67,5 +142,11 @@ func (c *client) Get(url string) (*response, error) {
 		}
 	}
 
-	return &response{Body: b, Type: t}, nil
+	return &response{
+		Status:       res.StatusCode,
+		Body:         b,
+		Type:         t,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}, nil
 }
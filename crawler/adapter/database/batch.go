@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// batcher collects inserts and existence checks from concurrent callers for
+// a short window and sends them to Postgres as one pipelined pgx.Batch. Every
+// caller still blocks until its own statement ran and gets its own result.
+// Everything else goes straight to the wrapped database.
+type batcher struct {
+	*database
+	window time.Duration
+	size   int
+	ops    chan *op
+	done   chan struct{}
+}
+
+type op struct {
+	sql   string
+	args  []any
+	query bool // scans a single bool instead of counting affected rows
+	res   chan result
+}
+
+type result struct {
+	ok  bool
+	err error
+}
+
+func NewBatcher(db *database, window time.Duration, size int) *batcher {
+	if size < 1 {
+		size = 1
+	}
+	b := &batcher{
+		database: db,
+		window:   window,
+		size:     size,
+		ops:      make(chan *op, size),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Close flushes what is pending before closing the connection pool. Nothing
+// may be submitted after Close was called.
+func (b *batcher) Close() {
+	close(b.ops)
+	<-b.done
+	b.database.Close()
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	for {
+		first, ok := <-b.ops
+		if !ok {
+			return
+		}
+
+		ops := []*op{first}
+		timer := time.NewTimer(b.window)
+	collect:
+		for len(ops) < b.size {
+			select {
+			case o, ok := <-b.ops:
+				if !ok {
+					break collect
+				}
+				ops = append(ops, o)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		b.flush(ops)
+	}
+}
+
+func (b *batcher) flush(ops []*op) {
+	batch := &pgx.Batch{}
+	for _, o := range ops {
+		batch.Queue(o.sql, o.args...)
+	}
+
+	br := b.conn.SendBatch(context.Background(), batch)
+	results := make([]result, len(ops))
+	failed := false
+	for i, o := range ops {
+		results[i] = o.fromBatch(br)
+		failed = failed || results[i].err != nil
+	}
+	if err := br.Close(); err != nil {
+		failed = true
+	}
+
+	if failed {
+		// the batch runs as one implicit transaction, so a single bad
+		// statement takes the others down with it. Run them one by one to
+		// only fail the one that is actually at fault.
+		for _, o := range ops {
+			o.res <- o.run(b.conn)
+		}
+		return
+	}
+
+	for i, o := range ops {
+		o.res <- results[i]
+	}
+}
+
+func (o *op) fromBatch(br pgx.BatchResults) result {
+	if o.query {
+		ok := false
+		err := br.QueryRow().Scan(&ok)
+		return result{ok: ok, err: err}
+	}
+	ok, err := conflictResult(br.Exec())
+	return result{ok: ok, err: err}
+}
+
+func (o *op) run(conn *pgxpool.Pool) result {
+	if o.query {
+		ok := false
+		err := conn.QueryRow(context.Background(), o.sql, o.args...).Scan(&ok)
+		return result{ok: ok, err: err}
+	}
+	ok, err := conflictResult(conn.Exec(context.Background(), o.sql, o.args...))
+	return result{ok: ok, err: err}
+}
+
+func (b *batcher) submit(o *op) (bool, error) {
+	o.res = make(chan result, 1)
+	b.ops <- o
+	res := <-o.res
+	return res.ok, res.err
+}
+
+func (b *batcher) InsertUrl(hash string) (bool, error) {
+	return b.submit(&op{
+		sql:  `INSERT INTO "visited" (hash) VALUES ($1) ON CONFLICT DO NOTHING;`,
+		args: []any{hash},
+	})
+}
+
+func (b *batcher) ExistUrl(hash string) (bool, error) {
+	return b.submit(&op{
+		sql:   `SELECT EXISTS (SELECT 1 FROM visited where hash = $1);`,
+		args:  []any{hash},
+		query: true,
+	})
+}
+
+func (b *batcher) InsertImage(info *ImageInfo) (bool, error) {
+	sql, args := insertImageQuery(info)
+	return b.submit(&op{sql: sql, args: args})
+}
+
+func (b *batcher) InsertLabel(hash, label string) (bool, error) {
+	return b.submit(&op{sql: insertLabelQuery, args: []any{hash, label}})
+}
+
+func (b *batcher) InsertMapping(imgHash, lblHash string) (bool, error) {
+	return b.submit(&op{sql: insertMappingQuery, args: []any{imgHash, lblHash}})
+}
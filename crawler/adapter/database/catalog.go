@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+)
+
+// Catalog is what there is to ask about the collected images.
+type Catalog interface {
+	// Image returns nil if there is no image with hash.
+	Image(hash string) (*ImageInfo, error)
+	ImageLabels(hash string) ([]string, error)
+	// FindImages returns the images that pass f, the latest crawled first.
+	FindImages(f *ImageFilter) ([]*ImageInfo, error)
+	// SearchLabels returns the images with a label that matches the words of
+	// query, the best match first.
+	SearchLabels(query string, limit, offset int) ([]*LabelMatch, error)
+}
+
+type ImageInfo struct {
+	Hash       string
+	Url        string
+	Format     string
+	Size       int
+	Width      int
+	Height     int
+	Entropy    float64
+	ColorSpace string
+	BlurHash   string
+	ThumbHash  string
+	CreatedAt  time.Time
+}
+
+// NewImageInfo describes img for InsertImage. The entropy and placeholders
+// take passes over the pixels, so it belongs before a transaction is begun,
+// not in it.
+func NewImageInfo(hash, url string, img *image.Image) *ImageInfo {
+	return &ImageInfo{
+		Hash:       hash,
+		Url:        url,
+		Format:     img.Format,
+		Size:       img.Size,
+		Width:      img.Width,
+		Height:     img.Height,
+		Entropy:    img.Entropy(),
+		ColorSpace: string(img.ColorSpace),
+		BlurHash:   img.BlurHash(),
+		ThumbHash:  img.ThumbHash(),
+	}
+}
+
+// ImageFilter leaves out images past any of its bounds, zero values are no
+// bound.
+type ImageFilter struct {
+	Format     string
+	MinWidth   int
+	MaxWidth   int
+	MinHeight  int
+	MaxHeight  int
+	MinEntropy float64
+	MaxEntropy float64
+	Since      time.Time
+	Until      time.Time
+	After      *ImageCursor // the last image of the previous page
+	Limit      int
+}
+
+// ImageCursor is where a page of FindImages ends, the next one starts after
+// it.
+type ImageCursor struct {
+	CreatedAt time.Time
+	Hash      string
+}
+
+type LabelMatch struct {
+	Image *ImageInfo
+	Label string
+	Rank  float64
+}
+
+const imageInfoColumns = `i.hash, COALESCE(i.url, ''), i.format, i.size, i.width,
+	i.height, i.entropy, i.color_space, COALESCE(i.blurhash, ''),
+	COALESCE(i.thumbhash, ''), i.created_at`
+
+func scanImageInfo(row pgx.Row, dest ...any) (*ImageInfo, error) {
+	info := &ImageInfo{}
+	err := row.Scan(append([]any{
+		&info.Hash,
+		&info.Url,
+		&info.Format,
+		&info.Size,
+		&info.Width,
+		&info.Height,
+		&info.Entropy,
+		&info.ColorSpace,
+		&info.BlurHash,
+		&info.ThumbHash,
+		&info.CreatedAt,
+	}, dest...)...)
+	return info, err
+}
+
+func (db *database) Image(hash string) (*ImageInfo, error) {
+	info, err := scanImageInfo(db.conn.QueryRow(
+		context.Background(),
+		`SELECT `+imageInfoColumns+` FROM image i WHERE i.hash = $1;`,
+		hash,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return info, err
+}
+
+func (db *database) ImageLabels(hash string) ([]string, error) {
+	rows, err := db.conn.Query(
+		context.Background(),
+		`SELECT l.label FROM label l
+			JOIN image_label_mapping m ON m.label_hash = l.hash
+			WHERE m.image_hash = $1 ORDER BY l.label;`,
+		hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []string{}
+	for rows.Next() {
+		label := ""
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+func (db *database) FindImages(f *ImageFilter) ([]*ImageInfo, error) {
+	conds, args := []string{"true"}, []any{}
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if len(f.Format) > 0 {
+		where("i.format = $%d", f.Format)
+	}
+	if f.MinWidth > 0 {
+		where("i.width >= $%d", f.MinWidth)
+	}
+	if f.MaxWidth > 0 {
+		where("i.width <= $%d", f.MaxWidth)
+	}
+	if f.MinHeight > 0 {
+		where("i.height >= $%d", f.MinHeight)
+	}
+	if f.MaxHeight > 0 {
+		where("i.height <= $%d", f.MaxHeight)
+	}
+	if f.MinEntropy > 0 {
+		where("i.entropy >= $%d", f.MinEntropy)
+	}
+	if f.MaxEntropy > 0 {
+		where("i.entropy <= $%d", f.MaxEntropy)
+	}
+	if !f.Since.IsZero() {
+		where("i.created_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		where("i.created_at < $%d", f.Until)
+	}
+	if f.After != nil {
+		args = append(args, f.After.CreatedAt, f.After.Hash)
+		conds = append(conds, fmt.Sprintf("(i.created_at, i.hash) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, f.Limit)
+
+	rows, err := db.conn.Query(
+		context.Background(),
+		fmt.Sprintf(
+			`SELECT `+imageInfoColumns+` FROM image i WHERE %s
+				ORDER BY i.created_at DESC, i.hash DESC LIMIT $%d;`,
+			strings.Join(conds, " AND "),
+			len(args),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*ImageInfo{}
+	for rows.Next() {
+		info, err := scanImageInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, info)
+	}
+	return images, rows.Err()
+}
+
+// SearchLabels takes query the way search engines do, quoted phrases, or and
+// a leading - to exclude a word.
+func (db *database) SearchLabels(query string, limit, offset int) ([]*LabelMatch, error) {
+	rows, err := db.conn.Query(
+		context.Background(),
+		`SELECT `+imageInfoColumns+`, l.label,
+				ts_rank(to_tsvector('simple', l.label), q)::float8 AS rank
+			FROM websearch_to_tsquery('simple', $1) q
+			JOIN label l ON to_tsvector('simple', l.label) @@ q
+			JOIN image_label_mapping m ON m.label_hash = l.hash
+			JOIN image i ON i.hash = m.image_hash
+			ORDER BY rank DESC, i.created_at DESC, i.hash
+			LIMIT $2 OFFSET $3;`,
+		query,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []*LabelMatch{}
+	for rows.Next() {
+		match := &LabelMatch{}
+		match.Image, err = scanImageInfo(rows, &match.Label, &match.Rank)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
@@ -0,0 +1,21 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database/databasetest"
+)
+
+func TestConformance(t *testing.T) {
+	databasetest.Run(t, database.Live())
+}
+
+func TestBatcherConformance(t *testing.T) {
+	databasetest.Run(t, database.LiveBatcher(10*time.Millisecond, 100))
+}
+
+func TestCatalogConformance(t *testing.T) {
+	databasetest.RunCatalog(t, database.LiveCatalog())
+}
@@ -4,19 +4,55 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
 )
 
 type Database interface {
 	Close()
+	Ping() error
 	InsertUrl(hash string) (bool, error)
 	ExistUrl(hash string) (bool, error)
-	InsertImage(hash string, img *image.Image) (bool, error)
+	// DeleteUrl takes back an InsertUrl whose url couldn't be queued.
+	DeleteUrl(hash string) error
+	Urls(fn func(hash string) error) error
+	IncrHost(host string) (int, error)
+	// DecrHost takes back an IncrHost whose page couldn't be queued.
+	DecrHost(host string) error
+	IncrHostImages(host string) (int, error)
+	HostImages(host string) (int, error)
+	// InsertImage ignores the CreatedAt of info, it is the time of insert.
+	InsertImage(info *ImageInfo) (bool, error)
 	InsertLabel(hash, label string) (bool, error)
 	InsertMapping(imgHash, lblHash string) (bool, error)
+	ExistImage(hash string) (bool, error)
+	Begin() (Tx, error)
+	Images(fn func(rec *ImageRecord) error) error
+	DeleteImage(hash string) error
+	Page(hash string) (*page.Page, error)
+	SavePage(p *page.Page) error
+	ClaimPages(now time.Time, lease time.Duration, limit int) ([]*page.Page, error)
+	SaveSeed(s *seed.Seed) error
+	Seed(url string) (*seed.Seed, error)
+	Seeds() ([]*seed.Seed, error)
+	RemoveSeed(url string) (bool, error)
+	IncrSeed(url string) (int, error)
+	// DecrSeed takes back an IncrSeed whose page couldn't be queued.
+	DecrSeed(url string) error
+	Spill(msg []byte, priority uint8, headers map[string]string) error
+	Spilled(limit int) ([]*Spilled, error)
+	Unspill(id int64) error
+}
+
+type ImageRecord struct {
+	Hash    string
+	Format  string
+	Url     string
+	Labeled bool
 }
 
 type database struct {
@@ -42,6 +78,10 @@ func (db *database) Close() {
 	db.conn.Close()
 }
 
+func (db *database) Ping() error {
+	return db.conn.Ping(context.Background())
+}
+
 func insertResult(err error) (bool, error) {
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -82,38 +122,196 @@ func (db *database) ExistUrl(hash string) (bool, error) {
 	return exist, nil
 }
 
-func (db *database) InsertImage(hash string, img *image.Image) (bool, error) {
-	_, err := db.conn.Exec(
+// execer is what the pool and a transaction have in common, so inserts can
+// run on either.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// conflictResult turns an ON CONFLICT DO NOTHING insert into the same result
+// insertResult gives. Unlike a unique_violation it doesn't abort transactions.
+func conflictResult(tag pgconn.CommandTag, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func insertImageQuery(info *ImageInfo) (string, []any) {
+	return `INSERT INTO "image" 
+			(hash, size, width, height, entropy, format, color_space, blurhash, thumbhash, url) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT DO NOTHING;`,
+		[]any{
+			info.Hash,
+			info.Size,
+			info.Width,
+			info.Height,
+			info.Entropy,
+			info.Format,
+			info.ColorSpace,
+			info.BlurHash,
+			info.ThumbHash,
+			info.Url,
+		}
+}
+
+const insertLabelQuery = `INSERT INTO "label" (hash, label) VALUES ($1, $2) 
+	ON CONFLICT DO NOTHING;`
+
+const insertMappingQuery = `INSERT INTO "image_label_mapping" 
+	(image_hash, label_hash) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+
+func insertImage(conn execer, info *ImageInfo) (bool, error) {
+	sql, args := insertImageQuery(info)
+	return conflictResult(conn.Exec(context.Background(), sql, args...))
+}
+
+func insertLabel(conn execer, hash, label string) (bool, error) {
+	return conflictResult(conn.Exec(context.Background(), insertLabelQuery, hash, label))
+}
+
+func insertMapping(conn execer, imgHash, lblHash string) (bool, error) {
+	return conflictResult(conn.Exec(context.Background(), insertMappingQuery, imgHash, lblHash))
+}
+
+func (db *database) InsertImage(info *ImageInfo) (bool, error) {
+	return insertImage(db.conn, info)
+}
+
+func (db *database) InsertLabel(hash, label string) (bool, error) {
+	return insertLabel(db.conn, hash, label)
+}
+
+func (db *database) InsertMapping(imgHash, lblHash string) (bool, error) {
+	return insertMapping(db.conn, imgHash, lblHash)
+}
+
+func (db *database) ExistImage(hash string) (bool, error) {
+	row := db.conn.QueryRow(
 		context.Background(),
-		`INSERT INTO "image" (hash, size, width, height, entropy, format) 
-			VALUES ($1, $2, $3, $4, $5, $6);`,
+		`SELECT EXISTS (
+			SELECT 1 FROM image where hash = $1
+		);`,
 		hash,
-		img.Size,
-		img.Width,
-		img.Height,
-		img.Entropy(),
-		img.Format,
 	)
-	return insertResult(err)
+
+	exist := false
+	if err := row.Scan(&exist); err != nil {
+		return false, err
+	}
+
+	return exist, nil
 }
 
-func (db *database) InsertLabel(hash, label string) (bool, error) {
+func (db *database) DeleteUrl(hash string) error {
 	_, err := db.conn.Exec(
 		context.Background(),
-		`INSERT INTO "label" (hash, label) VALUES ($1, $2);`,
+		`DELETE FROM visited WHERE hash = $1;`,
 		hash,
-		label,
 	)
-	return insertResult(err)
+	return err
 }
 
-func (db *database) InsertMapping(imgHash, lblHash string) (bool, error) {
+// Urls calls fn with the hash of every visited url.
+func (db *database) Urls(fn func(hash string) error) error {
+	rows, err := db.conn.Query(context.Background(), `SELECT hash FROM visited;`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hash := ""
+		if err := rows.Scan(&hash); err != nil {
+			return err
+		}
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// IncrHost counts one more page queued on host and returns the new count.
+func (db *database) IncrHost(host string) (int, error) {
+	pages := 0
+	err := db.conn.QueryRow(
+		context.Background(),
+		`INSERT INTO host (host, pages) VALUES ($1, 1)
+			ON CONFLICT (host) DO UPDATE SET pages = host.pages + 1
+			RETURNING pages;`,
+		host,
+	).Scan(&pages)
+	return pages, err
+}
+
+func (db *database) DecrHost(host string) error {
 	_, err := db.conn.Exec(
 		context.Background(),
-		`INSERT INTO "image_label_mapping" 
-			(image_hash, label_hash) VALUES ($1, $2);`,
-		imgHash,
-		lblHash,
+		`UPDATE host SET pages = pages - 1 WHERE host = $1 AND pages > 0;`,
+		host,
 	)
-	return insertResult(err)
+	return err
+}
+
+// IncrHostImages counts one more image accepted from a page on host and
+// returns the new count.
+func (db *database) IncrHostImages(host string) (int, error) {
+	images := 0
+	err := db.conn.QueryRow(
+		context.Background(),
+		`INSERT INTO host (host, images) VALUES ($1, 1)
+			ON CONFLICT (host) DO UPDATE SET images = host.images + 1
+			RETURNING images;`,
+		host,
+	).Scan(&images)
+	return images, err
+}
+
+func (db *database) HostImages(host string) (int, error) {
+	images := 0
+	err := db.conn.QueryRow(
+		context.Background(),
+		`SELECT COALESCE((SELECT images FROM host WHERE host = $1), 0);`,
+		host,
+	).Scan(&images)
+	return images, err
+}
+
+func (db *database) Images(fn func(rec *ImageRecord) error) error {
+	rows, err := db.conn.Query(
+		context.Background(),
+		`SELECT i.hash, i.format, COALESCE(i.url, ''), EXISTS (
+			SELECT 1 FROM image_label_mapping m WHERE m.image_hash = i.hash
+		) FROM image i;`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec := &ImageRecord{}
+		if err := rows.Scan(&rec.Hash, &rec.Format, &rec.Url, &rec.Labeled); err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (db *database) DeleteImage(hash string) error {
+	_, err := db.conn.Exec(
+		context.Background(),
+		`WITH mapping AS (
+			DELETE FROM image_label_mapping WHERE image_hash = $1
+		) DELETE FROM image WHERE hash = $1;`,
+		hash,
+	)
+	return err
 }
@@ -2,9 +2,12 @@ package database
 
 import (
 	"log"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 )
@@ -70,6 +73,10 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Could not connect to database: %s", err.Error())
 	}
 
+	if err := db.Migrate(); err != nil {
+		log.Fatalf("Could not migrate database: %s", err.Error())
+	}
+
 	defer func() {
 		db.Close()
 		if err := pool.Purge(resource); err != nil {
@@ -116,3 +123,183 @@ func TestExistUrl(t *testing.T) {
 		}
 	}
 }
+
+func TestTransaction(t *testing.T) {
+	b, err := os.ReadFile("../../test/non-trans.png")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	img, err := image.Load(b)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	ok, err := tx.InsertImage(NewImageInfo("wefowefjwoefj", "https://example.com/a.png", img))
+	if err != nil || !ok {
+		t.Errorf("insert not ok: %v", err)
+		return
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	exist, err := db.ExistImage("wefowefjwoefj")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if exist {
+		t.Error("image exists after rollback")
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	for i := 0; i < 2; i++ {
+		// the duplicate must not abort the transaction
+		ok, err := tx.InsertImage(NewImageInfo("wefowefjwoefj", "https://example.com/a.png", img))
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if ok != (i == 0) {
+			t.Errorf("got insert ok: %t, on attempt: %d", ok, i)
+		}
+	}
+	if _, err := tx.InsertLabel("oewfjwoefjwe", "a label"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err := tx.InsertMapping("wefowefjwoefj", "oewfjwoefjwe"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	exist, err = db.ExistImage("wefowefjwoefj")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !exist {
+		t.Error("image missing after commit")
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	b := NewBatcher(db, 20*time.Millisecond, 100)
+
+	input := []string{
+		"bwoeifjwoeifj",
+		"bvowiejvowiej",
+		"bsldkfjsldkfj",
+		"bwoeifjwoeifj",
+		"bwoeifjwoeifj",
+		"bvowiejvowiej",
+	}
+
+	results := make([]bool, len(input))
+	errs := make([]error, len(input))
+	wg := &sync.WaitGroup{}
+	for i, v := range input {
+		wg.Add(1)
+		go func(i int, v string) {
+			defer wg.Done()
+			results[i], errs[i] = b.InsertUrl(v)
+		}(i, v)
+	}
+	wg.Wait()
+
+	inserted := map[string]int{}
+	for i, v := range input {
+		if errs[i] != nil {
+			t.Error(errs[i].Error())
+			return
+		}
+		if results[i] {
+			inserted[v]++
+		}
+	}
+	for _, v := range input {
+		if inserted[v] != 1 {
+			t.Errorf("key: %s inserted %d times", v, inserted[v])
+		}
+		exist, err := b.ExistUrl(v)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !exist {
+			t.Errorf("missing key: %s", v)
+		}
+	}
+
+	// a failing statement must not take the rest of its batch down
+	wg.Add(2)
+	var mapErr, urlErr error
+	ok := false
+	go func() {
+		defer wg.Done()
+		_, mapErr = b.InsertMapping("nonexistentimg", "nonexistentlbl")
+	}()
+	go func() {
+		defer wg.Done()
+		ok, urlErr = b.InsertUrl("bpwoeifpwoeif")
+	}()
+	wg.Wait()
+	if mapErr == nil {
+		t.Error("mapping without image and label was inserted")
+	}
+	if urlErr != nil || !ok {
+		t.Errorf("insert not ok: %v", urlErr)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	version, latest, err := db.Version()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if version != latest {
+		t.Errorf("got version: %d, want: %d", version, latest)
+	}
+
+	// migrating twice is a no-op
+	if err := db.Migrate(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if err := db.Rollback(latest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	version, _, err = db.Version()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if version != 0 {
+		t.Errorf("got version after rollback: %d, want: 0", version)
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err := db.InsertUrl("mwoeifjwoeifj"); err != nil {
+		t.Errorf("schema not usable after migrating again: %s", err.Error())
+	}
+}
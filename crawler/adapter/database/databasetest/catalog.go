@@ -0,0 +1,171 @@
+package databasetest
+
+import (
+	"bytes"
+	"fmt"
+	goimage "image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+)
+
+// RunCatalog checks that db answers about the images stored in it like every
+// other catalog. Images of its own have unusual sizes, so db doesn't have to
+// be empty.
+func RunCatalog(t *testing.T, db interface {
+	database.Database
+	database.Catalog
+}) {
+	prefix := fmt.Sprintf("%x", time.Now().UnixNano())
+	key := func(name string) string { return prefix + name }
+
+	// inserted one after the other, so c is the latest
+	sizes := map[string][2]int{"a": {9, 9}, "b": {17, 9}, "c": {9, 17}}
+	labels := map[string]string{
+		"a": "a red fox " + prefix,
+		"b": "a red " + prefix + " car",
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		img := sizedImage(t, sizes[name][0], sizes[name][1])
+		info := database.NewImageInfo(key(name), "https://example.com/"+name+".png", img)
+		if _, err := db.InsertImage(info); err != nil {
+			t.Fatal(err.Error())
+		}
+		if label, ok := labels[name]; ok {
+			if _, err := db.InsertLabel(key("lbl"+name), label); err != nil {
+				t.Fatal(err.Error())
+			}
+			if _, err := db.InsertMapping(key(name), key("lbl"+name)); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer func() {
+		for _, name := range []string{"a", "b", "c"} {
+			if err := db.DeleteImage(key(name)); err != nil {
+				t.Error(err.Error())
+			}
+		}
+	}()
+
+	t.Run("Image", func(t *testing.T) {
+		info, err := db.Image(key("b"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if info == nil || info.Url != "https://example.com/b.png" || info.Format != "png" ||
+			info.Width != 17 || info.Height != 9 || info.Size < 1 || info.Entropy <= 0 ||
+			info.ColorSpace != "srgb" || len(info.BlurHash) < 1 || info.CreatedAt.IsZero() {
+			t.Errorf("unexpected image: %+v", info)
+		}
+		info, err = db.Image(key("missing"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if info != nil {
+			t.Errorf("got image that was never inserted: %+v", info)
+		}
+
+		got, err := db.ImageLabels(key("a"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(got) != 1 || got[0] != labels["a"] {
+			t.Errorf("got labels: %v, want: [%s]", got, labels["a"])
+		}
+		got, err = db.ImageLabels(key("c"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(got) != 0 {
+			t.Errorf("got labels: %v, want none", got)
+		}
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		filter := &database.ImageFilter{MinWidth: 9, MaxWidth: 17, MinHeight: 9, Format: "png", Limit: 2}
+		found := []string{}
+		for {
+			images, err := db.FindImages(filter)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			for _, info := range images {
+				found = append(found, info.Hash)
+			}
+			if len(images) < filter.Limit {
+				break
+			}
+			last := images[len(images)-1]
+			filter.After = &database.ImageCursor{CreatedAt: last.CreatedAt, Hash: last.Hash}
+		}
+		if fmt.Sprint(found) != fmt.Sprint([]string{key("c"), key("b"), key("a")}) {
+			t.Errorf("got images: %v, want c, b, a", found)
+		}
+
+		images, err := db.FindImages(&database.ImageFilter{MinWidth: 10, MaxHeight: 9, Limit: 10})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(images) != 1 || images[0].Hash != key("b") {
+			t.Errorf("got images: %+v, want b", images)
+		}
+		images, err = db.FindImages(&database.ImageFilter{
+			MinWidth: 9, MaxWidth: 17, MinHeight: 9,
+			Until: time.Now().Add(-time.Hour), Limit: 10,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(images) != 0 {
+			t.Errorf("got images crawled an hour ago: %+v", images)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		matches, err := db.SearchLabels("fox "+prefix, 10, 0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(matches) != 1 || matches[0].Image.Hash != key("a") || matches[0].Label != labels["a"] {
+			t.Errorf("unexpected matches: %+v", matches)
+		}
+
+		hashes := map[string]bool{}
+		for offset := 0; offset < 3; offset++ {
+			matches, err := db.SearchLabels("RED "+prefix, 1, offset)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			for _, m := range matches {
+				hashes[m.Image.Hash] = true
+			}
+		}
+		if len(hashes) != 2 || !hashes[key("a")] || !hashes[key("b")] {
+			t.Errorf("got images: %v, want a and b", hashes)
+		}
+	})
+}
+
+func sizedImage(t *testing.T, width, height int) *image.Image {
+	src := goimage.NewRGBA(goimage.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			src.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), uint8(x * y), 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err.Error())
+	}
+	img, err := image.Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return img
+}
@@ -0,0 +1,480 @@
+package databasetest
+
+import (
+	"bytes"
+	"fmt"
+	goimage "image"
+	"image/color"
+	"image/png"
+	gourl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+)
+
+// Run checks that db behaves like every other database. Keys get a unique
+// prefix, so db doesn't have to be empty.
+func Run(t *testing.T, db database.Database) {
+	prefix := fmt.Sprintf("%x", time.Now().UnixNano())
+	key := func(name string) string { return prefix + name }
+
+	t.Run("Ping", func(t *testing.T) {
+		if err := db.Ping(); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+
+	t.Run("Url", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			ok, err := db.InsertUrl(key("url"))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if ok != (i == 0) {
+				t.Errorf("got insert ok: %t, on attempt: %d", ok, i)
+			}
+		}
+		exist, err := db.ExistUrl(key("url"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !exist {
+			t.Error("missing url")
+		}
+		exist, err = db.ExistUrl(key("nourl"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if exist {
+			t.Error("url exists that was never inserted")
+		}
+
+		found := false
+		err = db.Urls(func(hash string) error {
+			found = found || hash == key("url")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !found {
+			t.Error("url not listed")
+		}
+
+		if err := db.DeleteUrl(key("url")); err != nil {
+			t.Fatal(err.Error())
+		}
+		ok, err := db.InsertUrl(key("url"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !ok {
+			t.Error("deleted url is still visited")
+		}
+	})
+
+	t.Run("Image", func(t *testing.T) {
+		img := testImage(t)
+		for i := 0; i < 2; i++ {
+			ok, err := db.InsertImage(database.NewImageInfo(key("img"), "https://example.com/a.png", img))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if ok != (i == 0) {
+				t.Errorf("got insert ok: %t, on attempt: %d", ok, i)
+			}
+		}
+		if _, err := db.InsertLabel(key("lbl"), "a label"); err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := db.InsertMapping(key("img"), key("missing")); err == nil {
+			t.Error("mapping to a missing label was inserted")
+		}
+		for i := 0; i < 2; i++ {
+			ok, err := db.InsertMapping(key("img"), key("lbl"))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if ok != (i == 0) {
+				t.Errorf("got insert ok: %t, on attempt: %d", ok, i)
+			}
+		}
+
+		rec := findImage(t, db, key("img"))
+		if rec == nil {
+			t.Fatal("image not listed")
+		}
+		if rec.Format != "png" || rec.Url != "https://example.com/a.png" || !rec.Labeled {
+			t.Errorf("unexpected record: %+v", rec)
+		}
+
+		if err := db.DeleteImage(key("img")); err != nil {
+			t.Fatal(err.Error())
+		}
+		exist, err := db.ExistImage(key("img"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if exist {
+			t.Error("image exists after delete")
+		}
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		img := testImage(t)
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := tx.InsertImage(database.NewImageInfo(key("tximg"), "", img)); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err.Error())
+		}
+		exist, err := db.ExistImage(key("tximg"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if exist {
+			t.Error("image exists after rollback")
+		}
+
+		tx, err = db.Begin()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for i := 0; i < 2; i++ {
+			// the duplicate must not abort the transaction
+			ok, err := tx.InsertImage(database.NewImageInfo(key("tximg"), "", img))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if ok != (i == 0) {
+				t.Errorf("got insert ok: %t, on attempt: %d", ok, i)
+			}
+		}
+		if _, err := tx.InsertLabel(key("txlbl"), "a label"); err != nil {
+			t.Fatal(err.Error())
+		}
+		// mapping rows inserted earlier in the same transaction
+		if _, err := tx.InsertMapping(key("tximg"), key("txlbl")); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err.Error())
+		}
+		rec := findImage(t, db, key("tximg"))
+		if rec == nil || !rec.Labeled {
+			t.Errorf("unexpected record after commit: %+v", rec)
+		}
+	})
+
+	t.Run("Host", func(t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			pages, err := db.IncrHost(key("example.com"))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if pages != i {
+				t.Errorf("got pages: %d, want: %d", pages, i)
+			}
+		}
+		if err := db.DecrHost(key("example.com")); err != nil {
+			t.Fatal(err.Error())
+		}
+		pages, err := db.IncrHost(key("example.com"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if pages != 3 {
+			t.Errorf("got pages after taking one back: %d, want: 3", pages)
+		}
+
+		// images are counted apart from pages
+		images, err := db.HostImages(key("example.com"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if images != 0 {
+			t.Errorf("got images: %d, want: 0", images)
+		}
+		for i := 1; i <= 2; i++ {
+			images, err := db.IncrHostImages(key("example.com"))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if images != i {
+				t.Errorf("got images: %d, want: %d", images, i)
+			}
+		}
+		images, err = db.HostImages(key("example.com"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if images != 2 {
+			t.Errorf("got images: %d, want: 2", images)
+		}
+	})
+
+	t.Run("Seed", func(t *testing.T) {
+		url := "https://" + key("seed") + ".com/"
+		s, err := db.Seed(url)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if s != nil {
+			t.Fatal("seed exists that was never added")
+		}
+		pages, err := db.IncrSeed(url)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if pages != 0 {
+			t.Errorf("counted pages of a missing seed: %d", pages)
+		}
+
+		added := &seed.Seed{
+			Url:    url,
+			Scope:  &scope.Scope{Mode: scope.Host, ExcludePaths: []string{"^/private"}},
+			Budget: 10,
+		}
+		if err := db.SaveSeed(added); err != nil {
+			t.Fatal(err.Error())
+		}
+		s, err = db.Seed(url)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if s == nil || s.Budget != 10 || s.Scope == nil || s.Scope.Mode != scope.Host || s.Removed {
+			t.Fatalf("got seed: %+v, want: %+v", s, added)
+		}
+		// the scope comes back ready to use
+		seedUrl, _ := gourl.Parse(url)
+		private, _ := gourl.Parse(url + "private/a")
+		if s.Scope.Link(seedUrl, private, 1) {
+			t.Error("loaded scope ignores its exclude paths")
+		}
+
+		for i := 1; i <= 2; i++ {
+			pages, err := db.IncrSeed(url)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if pages != i {
+				t.Errorf("got pages: %d, want: %d", pages, i)
+			}
+		}
+		if err := db.DecrSeed(url); err != nil {
+			t.Fatal(err.Error())
+		}
+		pages, err = db.IncrSeed(url)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if pages != 2 {
+			t.Errorf("got pages after taking one back: %d, want: 2", pages)
+		}
+
+		listed := func() bool {
+			seeds, err := db.Seeds()
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			for _, s := range seeds {
+				if s.Url == url {
+					return true
+				}
+			}
+			return false
+		}
+		if !listed() {
+			t.Error("seed not listed")
+		}
+
+		for i := 0; i < 2; i++ {
+			removed, err := db.RemoveSeed(url)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if removed != (i == 0) {
+				t.Errorf("got removed: %t, on attempt: %d", removed, i)
+			}
+		}
+		if listed() {
+			t.Error("removed seed listed")
+		}
+		s, err = db.Seed(url)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if s == nil || !s.Removed {
+			t.Errorf("got seed: %+v, want it removed", s)
+		}
+
+		// adding it again brings it back
+		if err := db.SaveSeed(&seed.Seed{Url: url}); err != nil {
+			t.Fatal(err.Error())
+		}
+		if !listed() {
+			t.Error("seed added again not listed")
+		}
+	})
+
+	t.Run("Overflow", func(t *testing.T) {
+		spilled := func() []*database.Spilled {
+			all, err := db.Spilled(1000)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			ours := []*database.Spilled{}
+			for _, s := range all {
+				if strings.HasPrefix(string(s.Msg), prefix) {
+					ours = append(ours, s)
+				}
+			}
+			return ours
+		}
+
+		traced := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+		for _, msg := range []struct {
+			name    string
+			prio    uint8
+			headers map[string]string
+		}{{"low", 1, nil}, {"high", 9, traced}, {"later", 9, nil}} {
+			if err := db.Spill([]byte(key(msg.name)), msg.prio, msg.headers); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		got := spilled()
+		want := []string{key("high"), key("later"), key("low")}
+		if len(got) != len(want) {
+			t.Fatalf("got spilled: %d, want: %d", len(got), len(want))
+		}
+		for i, s := range got {
+			if string(s.Msg) != want[i] {
+				t.Errorf("got spilled: %s, want: %s", string(s.Msg), want[i])
+			}
+		}
+		if got[0].Priority != 9 || got[2].Priority != 1 {
+			t.Errorf("got priorities: %d, %d", got[0].Priority, got[2].Priority)
+		}
+		if got[0].Headers["traceparent"] != traced["traceparent"] || len(got[1].Headers) > 0 {
+			t.Errorf("got headers: %v, %v", got[0].Headers, got[1].Headers)
+		}
+
+		for _, s := range got[:2] {
+			if err := db.Unspill(s.Id); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		got = spilled()
+		if len(got) != 1 || string(got[0].Msg) != key("low") {
+			t.Errorf("got spilled: %+v, want only: %s", got, key("low"))
+		}
+		if err := db.Unspill(got[0].Id); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+
+	t.Run("Page", func(t *testing.T) {
+		p, err := db.Page(key("page"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if p != nil {
+			t.Fatal("page exists that was never saved")
+		}
+
+		now := time.Now().Truncate(time.Second)
+		due := page.New(key("page"), "https://example.com/")
+		due.ETag = `"abc"`
+		due.Seed = "https://example.com/seed"
+		due.Depth = 2
+		due.Fetched(now.Add(-2*page.DefaultInterval), true)
+		due.FetchFailed(now.Add(-page.DefaultInterval))
+		later := page.New(key("later"), "https://example.com/later")
+		later.Fetched(now, false)
+		for _, p := range []*page.Page{due, later} {
+			if err := db.SavePage(p); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+
+		p, err = db.Page(key("page"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if p == nil || p.Url != due.Url || p.Seed != due.Seed || p.Depth != due.Depth ||
+			p.ETag != due.ETag || p.Interval != due.Interval ||
+			!p.NextFetch.Equal(due.NextFetch) || p.Fetches != 1 || p.Changes != 1 ||
+			p.Failures != 1 {
+			t.Errorf("got page: %+v, want: %+v", p, due)
+		}
+
+		claim := func() map[string]bool {
+			pages, err := db.ClaimPages(now, time.Hour, 1000)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			claimed := map[string]bool{}
+			for _, p := range pages {
+				claimed[p.Hash] = true
+			}
+			return claimed
+		}
+		claimed := claim()
+		if !claimed[key("page")] || claimed[key("later")] {
+			t.Errorf("unexpected claim: %v", claimed)
+		}
+		// claimed pages are leased
+		if claim()[key("page")] {
+			t.Error("page claimed twice")
+		}
+		p, err = db.Page(key("page"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !p.NextFetch.Equal(now.Add(time.Hour)) {
+			t.Errorf("got next fetch: %v, want: %v", p.NextFetch, now.Add(time.Hour))
+		}
+	})
+}
+
+func testImage(t *testing.T) *image.Image {
+	src := goimage.NewRGBA(goimage.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			src.Set(x, y, color.RGBA{uint8(x * 32), uint8(y * 32), 0, 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err.Error())
+	}
+	img, err := image.Load(buf.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return img
+}
+
+func findImage(t *testing.T, db database.Database, hash string) *database.ImageRecord {
+	var found *database.ImageRecord
+	err := db.Images(func(rec *database.ImageRecord) error {
+		if rec.Hash == hash {
+			found = rec
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return found
+}
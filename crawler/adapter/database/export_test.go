@@ -0,0 +1,23 @@
+package database
+
+import "time"
+
+// Live returns the database connected to the test container.
+func Live() Database {
+	return db
+}
+
+// LiveCatalog returns the database connected to the test container, with
+// what it tells about the images stored in it.
+func LiveCatalog() interface {
+	Database
+	Catalog
+} {
+	return db
+}
+
+// LiveBatcher batches on top of the database connected to the test
+// container. Closing it would close that database too, so it is left open.
+func LiveBatcher(window time.Duration, size int) Database {
+	return NewBatcher(db, window, size)
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+)
+
+// measured records the latency and errors of what the wrapped database does
+// for every url, maintenance and seed management go straight through.
+type measured struct {
+	Database
+}
+
+func NewMeasured(db Database) *measured {
+	return &measured{Database: db}
+}
+
+func measure[T any](op string, fn func() (T, error)) (T, error) {
+	start := time.Now()
+	v, err := fn()
+	metrics.Measure("database", op, start, err)
+	return v, err
+}
+
+func (db *measured) InsertUrl(hash string) (bool, error) {
+	return measure("insert_url", func() (bool, error) { return db.Database.InsertUrl(hash) })
+}
+
+func (db *measured) ExistUrl(hash string) (bool, error) {
+	return measure("exist_url", func() (bool, error) { return db.Database.ExistUrl(hash) })
+}
+
+func (db *measured) DeleteUrl(hash string) error {
+	_, err := measure("delete_url", func() (struct{}, error) { return struct{}{}, db.Database.DeleteUrl(hash) })
+	return err
+}
+
+func (db *measured) IncrHost(host string) (int, error) {
+	return measure("incr_host", func() (int, error) { return db.Database.IncrHost(host) })
+}
+
+func (db *measured) DecrHost(host string) error {
+	_, err := measure("decr_host", func() (struct{}, error) { return struct{}{}, db.Database.DecrHost(host) })
+	return err
+}
+
+func (db *measured) IncrHostImages(host string) (int, error) {
+	return measure("incr_host_images", func() (int, error) { return db.Database.IncrHostImages(host) })
+}
+
+func (db *measured) HostImages(host string) (int, error) {
+	return measure("host_images", func() (int, error) { return db.Database.HostImages(host) })
+}
+
+func (db *measured) ExistImage(hash string) (bool, error) {
+	return measure("exist_image", func() (bool, error) { return db.Database.ExistImage(hash) })
+}
+
+func (db *measured) Begin() (Tx, error) {
+	t, err := measure("begin", db.Database.Begin)
+	if err != nil {
+		return nil, err
+	}
+	return &measuredTx{Tx: t}, nil
+}
+
+// measuredTx records what is done in a transaction, rolling it back goes
+// straight through.
+type measuredTx struct {
+	Tx
+}
+
+func (t *measuredTx) InsertImage(info *ImageInfo) (bool, error) {
+	return measure("tx_insert_image", func() (bool, error) { return t.Tx.InsertImage(info) })
+}
+
+func (t *measuredTx) InsertLabel(hash, label string) (bool, error) {
+	return measure("tx_insert_label", func() (bool, error) { return t.Tx.InsertLabel(hash, label) })
+}
+
+func (t *measuredTx) InsertMapping(imgHash, lblHash string) (bool, error) {
+	return measure("tx_insert_mapping", func() (bool, error) { return t.Tx.InsertMapping(imgHash, lblHash) })
+}
+
+func (t *measuredTx) Commit() error {
+	_, err := measure("tx_commit", func() (struct{}, error) { return struct{}{}, t.Tx.Commit() })
+	return err
+}
+
+func (db *measured) Page(hash string) (*page.Page, error) {
+	return measure("page", func() (*page.Page, error) { return db.Database.Page(hash) })
+}
+
+func (db *measured) SavePage(p *page.Page) error {
+	_, err := measure("save_page", func() (struct{}, error) { return struct{}{}, db.Database.SavePage(p) })
+	return err
+}
+
+func (db *measured) ClaimPages(now time.Time, lease time.Duration, limit int) ([]*page.Page, error) {
+	return measure("claim_pages", func() ([]*page.Page, error) {
+		return db.Database.ClaimPages(now, lease, limit)
+	})
+}
+
+func (db *measured) Seed(url string) (*seed.Seed, error) {
+	return measure("seed", func() (*seed.Seed, error) { return db.Database.Seed(url) })
+}
+
+func (db *measured) IncrSeed(url string) (int, error) {
+	return measure("incr_seed", func() (int, error) { return db.Database.IncrSeed(url) })
+}
+
+func (db *measured) DecrSeed(url string) error {
+	_, err := measure("decr_seed", func() (struct{}, error) { return struct{}{}, db.Database.DecrSeed(url) })
+	return err
+}
+
+func (db *measured) Spill(msg []byte, priority uint8, headers map[string]string) error {
+	_, err := measure("spill", func() (struct{}, error) {
+		return struct{}{}, db.Database.Spill(msg, priority, headers)
+	})
+	return err
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the advisory lock key held while migrating, so crawlers
+// starting at the same time don't run the same migration twice.
+const migrationLock = 7264937201
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// migrations reads the embedded files named <version>_<name>.<up|down>.sql
+// ordered by version.
+func migrations() ([]*migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		parts := strings.SplitN(e.Name(), "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name '%s'", e.Name())
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name '%s'", e.Name())
+		}
+		b, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version}
+			byVersion[version] = m
+		}
+		switch {
+		case strings.HasSuffix(parts[1], ".up.sql"):
+			m.name = strings.TrimSuffix(parts[1], ".up.sql")
+			m.up = string(b)
+		case strings.HasSuffix(parts[1], ".down.sql"):
+			m.down = string(b)
+		default:
+			return nil, fmt.Errorf("invalid migration file name '%s'", e.Name())
+		}
+	}
+
+	ms := []*migration{}
+	for _, m := range byVersion {
+		if len(m.up) < 1 || len(m.down) < 1 {
+			return nil, fmt.Errorf("migration %04d needs an up and a down file", m.version)
+		}
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].version < ms[j].version })
+
+	return ms, nil
+}
+
+func (db *database) withLock(fn func(conn *pgxpool.Conn, current int) error) error {
+	ctx := context.Background()
+	// advisory locks belong to a session, so everything has to run on the
+	// same connection
+	conn, err := db.conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1);`, migrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(ctx, `SELECT pg_advisory_unlock($1);`, migrationLock)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`)
+	if err != nil {
+		return err
+	}
+
+	current := 0
+	err = conn.QueryRow(
+		ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_version;`,
+	).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, current)
+}
+
+func apply(conn *pgxpool.Conn, sql, record string, args ...any) error {
+	ctx := context.Background()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Migrate applies every migration newer than the current schema version,
+// each in its own transaction.
+func (db *database) Migrate() error {
+	ms, err := migrations()
+	if err != nil {
+		return err
+	}
+
+	return db.withLock(func(conn *pgxpool.Conn, current int) error {
+		for _, m := range ms {
+			if m.version <= current {
+				continue
+			}
+			err := apply(
+				conn,
+				m.up,
+				`INSERT INTO schema_version (version, name) VALUES ($1, $2);`,
+				m.version,
+				m.name,
+			)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+			}
+			slog.Info("applied migration", "adapter", "database", "version", m.version, "name", m.name)
+		}
+		return nil
+	})
+}
+
+// Rollback reverts the given number of most recent migrations.
+func (db *database) Rollback(steps int) error {
+	ms, err := migrations()
+	if err != nil {
+		return err
+	}
+
+	return db.withLock(func(conn *pgxpool.Conn, current int) error {
+		for i := len(ms) - 1; i >= 0 && steps > 0; i-- {
+			m := ms[i]
+			if m.version > current {
+				continue
+			}
+			err := apply(
+				conn,
+				m.down,
+				`DELETE FROM schema_version WHERE version = $1;`,
+				m.version,
+			)
+			if err != nil {
+				return fmt.Errorf("rollback %04d_%s: %w", m.version, m.name, err)
+			}
+			slog.Info("rolled back migration", "adapter", "database", "version", m.version, "name", m.name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// Version returns the current schema version and the newest one known.
+func (db *database) Version() (int, int, error) {
+	ms, err := migrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	latest := 0
+	if len(ms) > 0 {
+		latest = ms[len(ms)-1].version
+	}
+
+	version := 0
+	err = db.withLock(func(conn *pgxpool.Conn, current int) error {
+		version = current
+		return nil
+	})
+	return version, latest, err
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS image_label_mapping;
+DROP TABLE IF EXISTS label;
+DROP TABLE IF EXISTS image;
+DROP TABLE IF EXISTS visited;
@@ -0,0 +1,37 @@
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE IF NOT EXISTS visited (
+  hash VARCHAR(64) PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS image (
+  hash VARCHAR(64) PRIMARY KEY,
+  size INTEGER NOT NULL,
+  format VARCHAR(10) NOT NULL,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  entropy DOUBLE PRECISION NOT NULL,
+  color_space VARCHAR(16) NOT NULL DEFAULT 'srgb',
+  blurhash VARCHAR(64) DEFAULT NULL,
+  thumbhash VARCHAR(64) DEFAULT NULL,
+  url TEXT DEFAULT NULL,
+  dino_embedding VECTOR(1536) DEFAULT NULL,
+  clip_embedding VECTOR(768) DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS label (
+  hash VARCHAR(64) PRIMARY KEY,
+  label TEXT NOT NULL 
+);
+
+CREATE TABLE IF NOT EXISTS image_label_mapping (
+  image_hash VARCHAR(64) REFERENCES image(hash),
+  label_hash VARCHAR(64) REFERENCES label(hash),
+  UNIQUE (image_hash, label_hash)
+);
+
+-- deployments created from init.sql before these columns existed
+ALTER TABLE image ADD COLUMN IF NOT EXISTS color_space VARCHAR(16) NOT NULL DEFAULT 'srgb';
+ALTER TABLE image ADD COLUMN IF NOT EXISTS blurhash VARCHAR(64) DEFAULT NULL;
+ALTER TABLE image ADD COLUMN IF NOT EXISTS thumbhash VARCHAR(64) DEFAULT NULL;
+ALTER TABLE image ADD COLUMN IF NOT EXISTS url TEXT DEFAULT NULL;
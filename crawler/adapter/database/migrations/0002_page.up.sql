@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS page (
+  hash VARCHAR(64) PRIMARY KEY,
+  url TEXT NOT NULL,
+  etag TEXT NOT NULL DEFAULT '',
+  last_modified TEXT NOT NULL DEFAULT '',
+  content_hash VARCHAR(64) NOT NULL DEFAULT '',
+  fetched_at TIMESTAMPTZ NOT NULL,
+  next_fetch TIMESTAMPTZ NOT NULL,
+  interval_seconds BIGINT NOT NULL,
+  fetches INTEGER NOT NULL DEFAULT 0,
+  changes INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS page_next_fetch_idx ON page (next_fetch);
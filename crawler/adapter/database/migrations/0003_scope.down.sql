@@ -0,0 +1,3 @@
+ALTER TABLE page DROP COLUMN IF EXISTS depth;
+ALTER TABLE page DROP COLUMN IF EXISTS seed;
+DROP TABLE IF EXISTS host;
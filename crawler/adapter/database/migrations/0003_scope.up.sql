@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS host (
+  host TEXT PRIMARY KEY,
+  pages BIGINT NOT NULL DEFAULT 0
+);
+
+-- revisits keep the scope of the seed the page was found from
+ALTER TABLE page ADD COLUMN IF NOT EXISTS seed TEXT NOT NULL DEFAULT '';
+ALTER TABLE page ADD COLUMN IF NOT EXISTS depth INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS seed (
+  url TEXT PRIMARY KEY,
+  scope JSONB DEFAULT NULL,
+  budget INTEGER NOT NULL DEFAULT 0,
+  pages BIGINT NOT NULL DEFAULT 0,
+  removed BOOLEAN NOT NULL DEFAULT false,
+  added_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1 @@
+ALTER TABLE host DROP COLUMN IF EXISTS images;
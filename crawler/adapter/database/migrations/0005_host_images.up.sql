@@ -0,0 +1,2 @@
+-- images accepted from pages on the host, to rank its links
+ALTER TABLE host ADD COLUMN IF NOT EXISTS images BIGINT NOT NULL DEFAULT 0;
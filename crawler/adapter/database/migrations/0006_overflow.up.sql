@@ -0,0 +1,7 @@
+-- queue messages put aside while the queue was full
+CREATE TABLE IF NOT EXISTS overflow (
+  id BIGSERIAL PRIMARY KEY,
+  msg BYTEA NOT NULL,
+  priority SMALLINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS overflow_priority_idx ON overflow (priority DESC, id);
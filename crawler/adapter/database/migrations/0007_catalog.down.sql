@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS label_search_idx;
+DROP INDEX IF EXISTS image_created_at_idx;
+ALTER TABLE image DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,5 @@
+-- when an image was crawled, the ones from before count as crawled now
+ALTER TABLE image ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS image_created_at_idx ON image (created_at DESC, hash DESC);
+-- alt texts come in any language, so words aren't stemmed
+CREATE INDEX IF NOT EXISTS label_search_idx ON label USING GIN (to_tsvector('simple', label));
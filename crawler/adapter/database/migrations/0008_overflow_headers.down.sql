@@ -0,0 +1 @@
+ALTER TABLE overflow DROP COLUMN IF EXISTS headers;
@@ -0,0 +1,2 @@
+-- the headers of a spilled message, its trace context
+ALTER TABLE overflow ADD COLUMN IF NOT EXISTS headers JSONB;
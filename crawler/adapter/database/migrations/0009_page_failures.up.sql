@@ -0,0 +1,2 @@
+-- failed fetches of a page in a row, to back off its revisits
+ALTER TABLE page ADD COLUMN IF NOT EXISTS failures INT NOT NULL DEFAULT 0;
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+)
+
+// Spilled is a queue message put aside while the queue was full.
+type Spilled struct {
+	Id       int64
+	Msg      []byte
+	Priority uint8
+	Headers  map[string]string
+}
+
+func (db *database) Spill(msg []byte, priority uint8, headers map[string]string) error {
+	_, err := db.conn.Exec(
+		context.Background(),
+		`INSERT INTO overflow (msg, priority, headers) VALUES ($1, $2, $3);`,
+		msg,
+		int16(priority),
+		headers,
+	)
+	return err
+}
+
+// Spilled returns up to limit spilled messages, the highest priority and
+// oldest first.
+func (db *database) Spilled(limit int) ([]*Spilled, error) {
+	rows, err := db.conn.Query(
+		context.Background(),
+		`SELECT id, msg, priority, headers FROM overflow
+			ORDER BY priority DESC, id LIMIT $1;`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spilled := []*Spilled{}
+	for rows.Next() {
+		s := &Spilled{}
+		var prio int16
+		if err := rows.Scan(&s.Id, &s.Msg, &prio, &s.Headers); err != nil {
+			return nil, err
+		}
+		s.Priority = uint8(prio)
+		spilled = append(spilled, s)
+	}
+	return spilled, rows.Err()
+}
+
+// Unspill drops the spilled message id once it is back on the queue.
+func (db *database) Unspill(id int64) error {
+	_, err := db.conn.Exec(
+		context.Background(),
+		`DELETE FROM overflow WHERE id = $1;`,
+		id,
+	)
+	return err
+}
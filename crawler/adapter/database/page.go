@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+)
+
+const pageColumns = `hash, url, seed, depth, etag, last_modified, content_hash,
+	fetched_at, next_fetch, interval_seconds, fetches, changes, failures`
+
+func scanPage(row pgx.Row) (*page.Page, error) {
+	p := &page.Page{}
+	seconds := int64(0)
+	err := row.Scan(
+		&p.Hash,
+		&p.Url,
+		&p.Seed,
+		&p.Depth,
+		&p.ETag,
+		&p.LastModified,
+		&p.ContentHash,
+		&p.FetchedAt,
+		&p.NextFetch,
+		&seconds,
+		&p.Fetches,
+		&p.Changes,
+		&p.Failures,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.Interval = time.Duration(seconds) * time.Second
+	return p, nil
+}
+
+// Page returns nil if the page was never fetched.
+func (db *database) Page(hash string) (*page.Page, error) {
+	p, err := scanPage(db.conn.QueryRow(
+		context.Background(),
+		`SELECT `+pageColumns+` FROM page WHERE hash = $1;`,
+		hash,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (db *database) SavePage(p *page.Page) error {
+	_, err := db.conn.Exec(
+		context.Background(),
+		`INSERT INTO page (`+pageColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (hash) DO UPDATE SET
+				url = EXCLUDED.url,
+				seed = EXCLUDED.seed,
+				depth = EXCLUDED.depth,
+				etag = EXCLUDED.etag,
+				last_modified = EXCLUDED.last_modified,
+				content_hash = EXCLUDED.content_hash,
+				fetched_at = EXCLUDED.fetched_at,
+				next_fetch = EXCLUDED.next_fetch,
+				interval_seconds = EXCLUDED.interval_seconds,
+				fetches = EXCLUDED.fetches,
+				changes = EXCLUDED.changes,
+				failures = EXCLUDED.failures;`,
+		p.Hash,
+		p.Url,
+		p.Seed,
+		p.Depth,
+		p.ETag,
+		p.LastModified,
+		p.ContentHash,
+		p.FetchedAt,
+		p.NextFetch,
+		int64(p.Interval/time.Second),
+		p.Fetches,
+		p.Changes,
+		p.Failures,
+	)
+	return err
+}
+
+// ClaimPages returns up to limit pages due at now and moves their next fetch
+// lease into the future, so crawlers claiming at the same time don't get the
+// same pages and a page that never gets fetched comes up again.
+func (db *database) ClaimPages(now time.Time, lease time.Duration, limit int) ([]*page.Page, error) {
+	rows, err := db.conn.Query(
+		context.Background(),
+		`UPDATE page SET next_fetch = $2 WHERE hash IN (
+			SELECT hash FROM page WHERE next_fetch <= $1
+			ORDER BY next_fetch LIMIT $3 FOR UPDATE SKIP LOCKED
+		) RETURNING `+pageColumns+`;`,
+		now,
+		now.Add(lease),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := []*page.Page{}
+	for rows.Next() {
+		p, err := scanPage(rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, p)
+	}
+
+	return pages, rows.Err()
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+)
+
+func scanSeed(row pgx.Row) (*seed.Seed, error) {
+	s := &seed.Seed{}
+	var raw []byte
+	if err := row.Scan(&s.Url, &raw, &s.Budget, &s.Removed); err != nil {
+		return nil, err
+	}
+	if raw != nil {
+		s.Scope = &scope.Scope{}
+		if err := json.Unmarshal(raw, s.Scope); err != nil {
+			return nil, err
+		}
+		if err := s.Scope.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// SaveSeed adds s or replaces its scope and budget. A removed seed is added
+// back, the pages already counted against its budget stay.
+func (db *database) SaveSeed(s *seed.Seed) error {
+	var raw []byte
+	if s.Scope != nil {
+		var err error
+		raw, err = json.Marshal(s.Scope)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.conn.Exec(
+		context.Background(),
+		`INSERT INTO seed (url, scope, budget) VALUES ($1, $2, $3)
+			ON CONFLICT (url) DO UPDATE SET
+				scope = EXCLUDED.scope,
+				budget = EXCLUDED.budget,
+				removed = false;`,
+		s.Url,
+		raw,
+		s.Budget,
+	)
+	return err
+}
+
+// Seed returns nil if url was never added as a seed.
+func (db *database) Seed(url string) (*seed.Seed, error) {
+	s, err := scanSeed(db.conn.QueryRow(
+		context.Background(),
+		`SELECT url, scope, budget, removed FROM seed WHERE url = $1;`,
+		url,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+// Seeds returns every seed that wasn't removed in the order they were added.
+func (db *database) Seeds() ([]*seed.Seed, error) {
+	rows, err := db.conn.Query(
+		context.Background(),
+		`SELECT url, scope, budget, removed FROM seed
+			WHERE NOT removed ORDER BY added_at, url;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seeds := []*seed.Seed{}
+	for rows.Next() {
+		s, err := scanSeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, s)
+	}
+	return seeds, rows.Err()
+}
+
+// RemoveSeed marks url as removed, so pages found from it are no longer
+// followed. It reports false if there was no such seed.
+func (db *database) RemoveSeed(url string) (bool, error) {
+	tag, err := db.conn.Exec(
+		context.Background(),
+		`UPDATE seed SET removed = true WHERE url = $1 AND NOT removed;`,
+		url,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// IncrSeed counts one more page queued from the seed at url and returns the
+// new count.
+func (db *database) IncrSeed(url string) (int, error) {
+	pages := 0
+	err := db.conn.QueryRow(
+		context.Background(),
+		`UPDATE seed SET pages = pages + 1 WHERE url = $1 RETURNING pages;`,
+		url,
+	).Scan(&pages)
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+	return pages, err
+}
+
+func (db *database) DecrSeed(url string) error {
+	_, err := db.conn.Exec(
+		context.Background(),
+		`UPDATE seed SET pages = pages - 1 WHERE url = $1 AND pages > 0;`,
+		url,
+	)
+	return err
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Tx interface {
+	InsertImage(info *ImageInfo) (bool, error)
+	InsertLabel(hash, label string) (bool, error)
+	InsertMapping(imgHash, lblHash string) (bool, error)
+	Commit() error
+	Rollback() error
+}
+
+type tx struct {
+	tx pgx.Tx
+}
+
+func (db *database) Begin() (Tx, error) {
+	t, err := db.conn.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &tx{tx: t}, nil
+}
+
+func (t *tx) InsertImage(info *ImageInfo) (bool, error) {
+	return insertImage(t.tx, info)
+}
+
+func (t *tx) InsertLabel(hash, label string) (bool, error) {
+	return insertLabel(t.tx, hash, label)
+}
+
+func (t *tx) InsertMapping(imgHash, lblHash string) (bool, error) {
+	return insertMapping(t.tx, imgHash, lblHash)
+}
+
+func (t *tx) Commit() error {
+	return t.tx.Commit(context.Background())
+}
+
+// Rollback after Commit does nothing but return an error, so it can always
+// be deferred.
+func (t *tx) Rollback() error {
+	return t.tx.Rollback(context.Background())
+}
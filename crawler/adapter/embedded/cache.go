@@ -0,0 +1,34 @@
+package embedded
+
+import bolt "go.etcd.io/bbolt"
+
+type cache struct {
+	store *store
+}
+
+func (s *store) Cache() *cache {
+	return &cache{store: s}
+}
+
+func (c *cache) Close() error {
+	return nil
+}
+
+func (c *cache) Ping() error {
+	return c.store.ping()
+}
+
+func (c *cache) Exist(hash string) (bool, error) {
+	exist := false
+	err := c.store.bolt.View(func(tx *bolt.Tx) error {
+		exist = tx.Bucket(cacheBucket).Get([]byte(hash)) != nil
+		return nil
+	})
+	return exist, err
+}
+
+func (c *cache) Set(hash string) error {
+	return c.store.bolt.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(cacheBucket).Put([]byte(hash), []byte{})
+	})
+}
@@ -0,0 +1,289 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+	bolt "go.etcd.io/bbolt"
+)
+
+// imageRow holds the columns of the image table, keyed by hash.
+type imageRow struct {
+	Size       int              `json:"size"`
+	Format     string           `json:"format"`
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	Entropy    float64          `json:"entropy"`
+	ColorSpace image.ColorSpace `json:"color_space"`
+	BlurHash   string           `json:"blurhash"`
+	ThumbHash  string           `json:"thumbhash"`
+	Url        string           `json:"url"`
+}
+
+type db struct {
+	store *store
+}
+
+func (s *store) Database() *db {
+	return &db{store: s}
+}
+
+func (d *db) Close() {}
+
+func (d *db) Ping() error {
+	return d.store.ping()
+}
+
+func mappingKey(imgHash, lblHash string) []byte {
+	return []byte(imgHash + "/" + lblHash)
+}
+
+// putIfAbsent mirrors INSERT ... ON CONFLICT DO NOTHING.
+func putIfAbsent(b *bolt.Bucket, key, val []byte) (bool, error) {
+	if b.Get(key) != nil {
+		return false, nil
+	}
+	return true, b.Put(key, val)
+}
+
+func insertImage(tx *bolt.Tx, info *database.ImageInfo) (bool, error) {
+	row, err := json.Marshal(&imageRow{
+		Size:       info.Size,
+		Format:     info.Format,
+		Width:      info.Width,
+		Height:     info.Height,
+		Entropy:    info.Entropy,
+		ColorSpace: image.ColorSpace(info.ColorSpace),
+		BlurHash:   info.BlurHash,
+		ThumbHash:  info.ThumbHash,
+		Url:        info.Url,
+	})
+	if err != nil {
+		return false, err
+	}
+	return putIfAbsent(tx.Bucket(imageBucket), []byte(info.Hash), row)
+}
+
+func insertLabel(tx *bolt.Tx, hash, label string) (bool, error) {
+	return putIfAbsent(tx.Bucket(labelBucket), []byte(hash), []byte(label))
+}
+
+// insertMapping enforces the foreign keys of image_label_mapping.
+func insertMapping(tx *bolt.Tx, imgHash, lblHash string) (bool, error) {
+	if tx.Bucket(imageBucket).Get([]byte(imgHash)) == nil {
+		return false, errors.New("image doesn't exist")
+	}
+	if tx.Bucket(labelBucket).Get([]byte(lblHash)) == nil {
+		return false, errors.New("label doesn't exist")
+	}
+	return putIfAbsent(tx.Bucket(mappingBucket), mappingKey(imgHash, lblHash), []byte{})
+}
+
+// update runs fn in a write transaction. bbolt's Batch coalesces the ones of
+// concurrent callers into a single commit, so there is one fsync per batch
+// instead of one per insert.
+func (d *db) update(fn func(tx *bolt.Tx) (bool, error)) (bool, error) {
+	ok := false
+	err := d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		// Batch may retry fn on its own, so reset what a failed run set
+		ok = false
+		var err error
+		ok, err = fn(tx)
+		return err
+	})
+	return ok, err
+}
+
+func (d *db) exists(bucket []byte, key string) (bool, error) {
+	exist := false
+	err := d.store.bolt.View(func(tx *bolt.Tx) error {
+		exist = tx.Bucket(bucket).Get([]byte(key)) != nil
+		return nil
+	})
+	return exist, err
+}
+
+func (d *db) InsertUrl(hash string) (bool, error) {
+	return d.update(func(tx *bolt.Tx) (bool, error) {
+		return putIfAbsent(tx.Bucket(visitedBucket), []byte(hash), []byte{})
+	})
+}
+
+func (d *db) ExistUrl(hash string) (bool, error) {
+	return d.exists(visitedBucket, hash)
+}
+
+func (d *db) DeleteUrl(hash string) error {
+	return d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(visitedBucket).Delete([]byte(hash))
+	})
+}
+
+// Urls walks the visited set in a single read transaction, fn must not
+// write.
+func (d *db) Urls(fn func(hash string) error) error {
+	return d.store.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(visitedBucket).ForEach(func(k, _ []byte) error {
+			return fn(string(k))
+		})
+	})
+}
+
+func (d *db) incr(bucket []byte, key string) (int, error) {
+	n := uint64(0)
+	err := d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		n = 1
+		if v := b.Get([]byte(key)); v != nil {
+			n += binary.BigEndian.Uint64(v)
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, n)
+		return b.Put([]byte(key), v)
+	})
+	return int(n), err
+}
+
+func (d *db) IncrHost(host string) (int, error) {
+	return d.incr(hostBucket, host)
+}
+
+func (d *db) DecrHost(host string) error {
+	return d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(hostBucket)
+		v := b.Get([]byte(host))
+		if v == nil || binary.BigEndian.Uint64(v) == 0 {
+			return nil
+		}
+		n := make([]byte, 8)
+		binary.BigEndian.PutUint64(n, binary.BigEndian.Uint64(v)-1)
+		return b.Put([]byte(host), n)
+	})
+}
+
+func (d *db) IncrHostImages(host string) (int, error) {
+	return d.incr(yieldBucket, host)
+}
+
+func (d *db) HostImages(host string) (int, error) {
+	n := 0
+	err := d.store.bolt.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(yieldBucket).Get([]byte(host)); v != nil {
+			n = int(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (d *db) InsertImage(info *database.ImageInfo) (bool, error) {
+	return d.update(func(tx *bolt.Tx) (bool, error) {
+		return insertImage(tx, info)
+	})
+}
+
+func (d *db) InsertLabel(hash, label string) (bool, error) {
+	return d.update(func(tx *bolt.Tx) (bool, error) {
+		return insertLabel(tx, hash, label)
+	})
+}
+
+func (d *db) InsertMapping(imgHash, lblHash string) (bool, error) {
+	return d.update(func(tx *bolt.Tx) (bool, error) {
+		return insertMapping(tx, imgHash, lblHash)
+	})
+}
+
+func (d *db) ExistImage(hash string) (bool, error) {
+	return d.exists(imageBucket, hash)
+}
+
+// Images reads every record before calling fn, fn may write meanwhile and
+// bbolt doesn't allow that while a read transaction is open.
+func (d *db) Images(fn func(rec *database.ImageRecord) error) error {
+	recs := []*database.ImageRecord{}
+	err := d.store.bolt.View(func(tx *bolt.Tx) error {
+		mappings := tx.Bucket(mappingBucket).Cursor()
+		return tx.Bucket(imageBucket).ForEach(func(k, v []byte) error {
+			row := &imageRow{}
+			if err := json.Unmarshal(v, row); err != nil {
+				return err
+			}
+			prefix := append(append([]byte{}, k...), '/')
+			key, _ := mappings.Seek(prefix)
+			recs = append(recs, &database.ImageRecord{
+				Hash:    string(k),
+				Format:  row.Format,
+				Url:     row.Url,
+				Labeled: key != nil && bytes.HasPrefix(key, prefix),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *db) DeleteImage(hash string) error {
+	return d.store.bolt.Update(func(tx *bolt.Tx) error {
+		prefix := []byte(hash + "/")
+		mappings := tx.Bucket(mappingBucket)
+		keys := [][]byte{}
+		c := mappings.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if err := mappings.Delete(k); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(imageBucket).Delete([]byte(hash))
+	})
+}
+
+// tx is a bbolt write transaction. It blocks every other writer until it is
+// closed and must stay on the goroutine that began it.
+type tx struct {
+	tx *bolt.Tx
+}
+
+func (d *db) Begin() (database.Tx, error) {
+	t, err := d.store.bolt.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{tx: t}, nil
+}
+
+func (t *tx) InsertImage(info *database.ImageInfo) (bool, error) {
+	return insertImage(t.tx, info)
+}
+
+func (t *tx) InsertLabel(hash, label string) (bool, error) {
+	return insertLabel(t.tx, hash, label)
+}
+
+func (t *tx) InsertMapping(imgHash, lblHash string) (bool, error) {
+	return insertMapping(t.tx, imgHash, lblHash)
+}
+
+func (t *tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *tx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -0,0 +1,102 @@
+package embedded
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache/cachetest"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database/databasetest"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue/queuetest"
+)
+
+func open(t *testing.T) *store {
+	s, err := Open(filepath.Join(t.TempDir(), "crawler.db"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestDatabase(t *testing.T) {
+	databasetest.Run(t, open(t).Database())
+}
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, open(t).Cache())
+}
+
+func TestQueue(t *testing.T) {
+	queuetest.Run(t, func(maxSize int) (queue.Queue, error) {
+		return open(t).Queue(maxSize), nil
+	})
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawler.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	q := s.Queue(2)
+	for _, msg := range []string{"a", "b"} {
+		if err := q.Push([]byte(msg), 0, nil); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := q.Push([]byte("c"), 0, nil); err != queue.ErrFull {
+		t.Errorf("got error: %v, want: %v", err, queue.ErrFull)
+	}
+	d, err := q.Pull()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatal(err.Error())
+	}
+	// pulled but never acknowledged
+	if _, err := q.Pull(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := s.Database().InsertUrl("wefoiwjefowi"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the frontier and visited set pick up where they were left, with the
+	// unacknowledged message back in front
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer s.Close()
+	exist, err := s.Database().ExistUrl("wefoiwjefowi")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !exist {
+		t.Error("visited url lost on reopen")
+	}
+	q = s.Queue(2)
+	if err := q.Push([]byte("d"), 0, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := q.Push([]byte("e"), 0, nil); err != queue.ErrFull {
+		t.Errorf("got error: %v, want: %v", err, queue.ErrFull)
+	}
+	for _, want := range []string{"b", "d"} {
+		d, err := q.Pull()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(d.Body()) != want {
+			t.Errorf("got message: %s, want: %s", string(d.Body()), want)
+		}
+		if err := d.Ack(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package embedded
+
+import (
+	"encoding/binary"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/priority"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Spilled messages are keyed like queued ones, so a cursor finds the highest
+// priority and oldest first. Their id is the sequence part of the key.
+func (d *db) Spill(msg []byte, prio uint8, headers map[string]string) error {
+	return d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(overflowBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := msgKey(prio, seq)
+		if err := b.Put(key, msg); err != nil {
+			return err
+		}
+		return putHeaders(tx.Bucket(overflowHeadersBucket), key, headers)
+	})
+}
+
+func (d *db) Spilled(limit int) ([]*database.Spilled, error) {
+	spilled := []*database.Spilled{}
+	err := d.store.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(overflowBucket).Cursor()
+		for k, v := c.First(); k != nil && len(spilled) < limit; k, v = c.Next() {
+			headers, err := getHeaders(tx.Bucket(overflowHeadersBucket), k)
+			if err != nil {
+				return err
+			}
+			spilled = append(spilled, &database.Spilled{
+				Id:       int64(binary.BigEndian.Uint64(k[1:])),
+				Msg:      append([]byte{}, v...),
+				Priority: keyPriority(k),
+				Headers:  headers,
+			})
+		}
+		return nil
+	})
+	return spilled, err
+}
+
+func (d *db) Unspill(id int64) error {
+	return d.store.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(overflowBucket)
+		for prio := 0; prio <= priority.Max; prio++ {
+			key := msgKey(uint8(prio), uint64(id))
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+			if err := tx.Bucket(overflowHeadersBucket).Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+	bolt "go.etcd.io/bbolt"
+)
+
+// dueKey orders pages by their next fetch in the due index.
+func dueKey(p *page.Page) []byte {
+	key := make([]byte, 8, 8+len(p.Hash))
+	binary.BigEndian.PutUint64(key, uint64(p.NextFetch.UnixNano()))
+	return append(key, p.Hash...)
+}
+
+func getPage(tx *bolt.Tx, hash string) (*page.Page, error) {
+	v := tx.Bucket(pageBucket).Get([]byte(hash))
+	if v == nil {
+		return nil, nil
+	}
+	p := &page.Page{}
+	return p, json.Unmarshal(v, p)
+}
+
+func putPage(tx *bolt.Tx, p *page.Page) error {
+	old, err := getPage(tx, p.Hash)
+	if err != nil {
+		return err
+	}
+	due := tx.Bucket(pageDueBucket)
+	if old != nil {
+		if err := due.Delete(dueKey(old)); err != nil {
+			return err
+		}
+	}
+
+	v, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(pageBucket).Put([]byte(p.Hash), v); err != nil {
+		return err
+	}
+	return due.Put(dueKey(p), []byte{})
+}
+
+func (d *db) Page(hash string) (*page.Page, error) {
+	var p *page.Page
+	err := d.store.bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		p, err = getPage(tx, hash)
+		return err
+	})
+	return p, err
+}
+
+func (d *db) SavePage(p *page.Page) error {
+	return d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		return putPage(tx, p)
+	})
+}
+
+func (d *db) ClaimPages(now time.Time, lease time.Duration, limit int) ([]*page.Page, error) {
+	pages := []*page.Page{}
+	err := d.store.bolt.Update(func(tx *bolt.Tx) error {
+		pages = pages[:0]
+		end := make([]byte, 8)
+		binary.BigEndian.PutUint64(end, uint64(now.UnixNano()))
+
+		hashes := []string{}
+		c := tx.Bucket(pageDueBucket).Cursor()
+		for k, _ := c.First(); k != nil && len(hashes) < limit; k, _ = c.Next() {
+			if bytes.Compare(k[:8], end) > 0 {
+				break
+			}
+			hashes = append(hashes, string(k[8:]))
+		}
+
+		for _, hash := range hashes {
+			p, err := getPage(tx, hash)
+			if err != nil {
+				return err
+			}
+			p.NextFetch = now.Add(lease)
+			if err := putPage(tx, p); err != nil {
+				return err
+			}
+			pages = append(pages, p)
+		}
+		return nil
+	})
+	return pages, err
+}
@@ -0,0 +1,421 @@
+package embedded
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/priority"
+	bolt "go.etcd.io/bbolt"
+)
+
+// msgQueue keeps messages under their inverted priority followed by a big
+// endian sequence number, so a cursor finds the next one first and they
+// survive a restart. The length is kept next to them. Like the RabbitMQ queue,
+// a pulled message waits in the unacked bucket until it is acknowledged,
+// comes back on the next Open if it never was, and new messages are refused
+// while maxSize messages are waiting. Retries are counted and headers kept in
+// buckets of their own under the key of the message, dead letters are kept in
+// order.
+type msgQueue struct {
+	store   *store
+	maxSize int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	pushed uint64
+	closed bool
+}
+
+var (
+	lenKey = []byte("queue_len")
+	// headKey is where stores from before priorities kept the sequence of
+	// the last pulled message. Their keys have no priority and sort first.
+	headKey = []byte("queue_head")
+)
+
+func (s *store) Queue(maxSize int) *msgQueue {
+	q := &msgQueue{store: s, maxSize: maxSize}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *msgQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *msgQueue) Ping() error {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return errors.New("queue has been closed")
+	}
+	return q.store.ping()
+}
+
+func msgKey(prio uint8, seq uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = priority.Max - min(prio, priority.Max)
+	binary.BigEndian.PutUint64(key[1:], seq)
+	return key
+}
+
+func length(tx *bolt.Tx) uint64 {
+	v := tx.Bucket(metaBucket).Get(lenKey)
+	if v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	head := uint64(0)
+	if v := tx.Bucket(metaBucket).Get(headKey); v != nil {
+		head = binary.BigEndian.Uint64(v)
+	}
+	return tx.Bucket(queueBucket).Sequence() - head
+}
+
+func setLength(tx *bolt.Tx, n uint64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, n)
+	return tx.Bucket(metaBucket).Put(lenKey, v)
+}
+
+// enqueue puts msg at the back of its priority and counts it.
+func enqueue(tx *bolt.Tx, msg []byte, prio uint8, retries int, headers map[string]string) error {
+	// before the sequence moves, stores from before the length was kept
+	// derive it from there
+	n := length(tx)
+	b := tx.Bucket(queueBucket)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := msgKey(prio, seq)
+	if err := b.Put(key, msg); err != nil {
+		return err
+	}
+	if retries > 0 {
+		if err := tx.Bucket(retriesBucket).Put(key, seqKey(uint64(retries))); err != nil {
+			return err
+		}
+	}
+	if err := putHeaders(tx.Bucket(headersBucket), key, headers); err != nil {
+		return err
+	}
+	return setLength(tx, n+1)
+}
+
+// putHeaders keeps headers under key, if there are any.
+func putHeaders(b *bolt.Bucket, key []byte, headers map[string]string) error {
+	if len(headers) < 1 {
+		return nil
+	}
+	v, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, v)
+}
+
+// getHeaders returns the headers kept under key, nil if there are none.
+func getHeaders(b *bolt.Bucket, key []byte) (map[string]string, error) {
+	v := b.Get(key)
+	if v == nil {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	if err := json.Unmarshal(v, &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// keyPriority is the priority a message was pushed with, the lowest for keys
+// from before priorities.
+func keyPriority(key []byte) uint8 {
+	if len(key) != 9 {
+		return 0
+	}
+	return priority.Max - key[0]
+}
+
+func (q *msgQueue) notify() {
+	q.mu.Lock()
+	q.pushed++
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+func (q *msgQueue) Push(msg []byte, prio uint8, headers map[string]string) error {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return errors.New("queue has been closed")
+	}
+
+	// failing the function would roll back the whole batch
+	full := false
+	err := q.store.bolt.Batch(func(tx *bolt.Tx) error {
+		full = q.maxSize > 0 && length(tx) >= uint64(q.maxSize)
+		if full {
+			return nil
+		}
+		return enqueue(tx, msg, prio, 0, headers)
+	})
+	if err != nil {
+		return err
+	}
+	if full {
+		return queue.ErrFull
+	}
+	q.notify()
+	return nil
+}
+
+func (q *msgQueue) pop() (*delivery, error) {
+	var d *delivery
+	err := q.store.bolt.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(queueBucket).Cursor()
+		key, v := c.First()
+		if key == nil {
+			return nil
+		}
+		d = &delivery{
+			queue: q,
+			key:   append([]byte{}, key...),
+			msg:   append([]byte{}, v...),
+		}
+		if v := tx.Bucket(retriesBucket).Get(key); v != nil {
+			d.retries = int(binary.BigEndian.Uint64(v))
+		}
+		headers, err := getHeaders(tx.Bucket(headersBucket), key)
+		if err != nil {
+			return err
+		}
+		d.headers = headers
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		if err := tx.Bucket(unackedBucket).Put(d.key, d.msg); err != nil {
+			return err
+		}
+		return setLength(tx, length(tx)-1)
+	})
+	return d, err
+}
+
+// requeueUnacked moves every pulled but unacknowledged message back to the
+// front of its priority.
+func requeueUnacked(tx *bolt.Tx) error {
+	unacked := tx.Bucket(unackedBucket)
+	n := uint64(0)
+	err := unacked.ForEach(func(k, v []byte) error {
+		n++
+		return tx.Bucket(queueBucket).Put(k, v)
+	})
+	if err != nil || n < 1 {
+		return err
+	}
+	if err := tx.DeleteBucket(unackedBucket); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket(unackedBucket); err != nil {
+		return err
+	}
+	slog.Info("requeued unacknowledged messages", "adapter", "embedded", "messages", n)
+	return setLength(tx, length(tx)+n)
+}
+
+type delivery struct {
+	queue   *msgQueue
+	key     []byte
+	msg     []byte
+	headers map[string]string
+	retries int
+}
+
+func (d *delivery) Body() []byte {
+	return d.msg
+}
+
+func (d *delivery) Headers() map[string]string {
+	return d.headers
+}
+
+// settle removes the message from the unacked bucket and calls fn in the same
+// transaction, if it was still there.
+func (d *delivery) settle(fn func(tx *bolt.Tx) error) error {
+	return d.queue.store.bolt.Update(func(tx *bolt.Tx) error {
+		unacked := tx.Bucket(unackedBucket)
+		if unacked.Get(d.key) == nil {
+			return errors.New("delivery already acknowledged")
+		}
+		if err := unacked.Delete(d.key); err != nil {
+			return err
+		}
+		if err := tx.Bucket(retriesBucket).Delete(d.key); err != nil {
+			return err
+		}
+		if err := tx.Bucket(headersBucket).Delete(d.key); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+func (d *delivery) Ack() error {
+	return d.settle(func(tx *bolt.Tx) error { return nil })
+}
+
+func (d *delivery) Nack(requeue bool) error {
+	if !requeue {
+		return d.Reject("rejected")
+	}
+	if d.retries+1 > queue.MaxRetries {
+		return d.Reject("too many retries")
+	}
+	err := d.settle(func(tx *bolt.Tx) error {
+		return enqueue(tx, d.msg, keyPriority(d.key), d.retries+1, d.headers)
+	})
+	if err != nil {
+		return err
+	}
+	d.queue.notify()
+	return nil
+}
+
+func (d *delivery) Reject(reason string) error {
+	return d.settle(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deadBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(&queue.DeadLetter{
+			Body:     d.msg,
+			Priority: keyPriority(d.key),
+			Headers:  d.headers,
+			Reason:   reason,
+			Retries:  d.retries,
+			DeadAt:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		return b.Put(seqKey(seq), v)
+	})
+}
+
+// dead calls fn with up to limit dead letters in the order they died.
+func dead(tx *bolt.Tx, limit int, fn func(key []byte, letter *queue.DeadLetter) error) error {
+	c := tx.Bucket(deadBucket).Cursor()
+	n := 0
+	for k, v := c.First(); k != nil && (limit < 1 || n < limit); k, v = c.Next() {
+		letter := &queue.DeadLetter{}
+		if err := json.Unmarshal(v, letter); err != nil {
+			return err
+		}
+		if err := fn(k, letter); err != nil {
+			return err
+		}
+		n++
+	}
+	return nil
+}
+
+func (q *msgQueue) Len() (int, error) {
+	n := uint64(0)
+	err := q.store.bolt.View(func(tx *bolt.Tx) error {
+		n = length(tx)
+		return nil
+	})
+	return int(n), err
+}
+
+func (q *msgQueue) DeadLetters(limit int) ([]*queue.DeadLetter, error) {
+	letters := []*queue.DeadLetter{}
+	err := q.store.bolt.View(func(tx *bolt.Tx) error {
+		return dead(tx, limit, func(_ []byte, letter *queue.DeadLetter) error {
+			letters = append(letters, letter)
+			return nil
+		})
+	})
+	return letters, err
+}
+
+func (q *msgQueue) Requeue(limit int) (int, error) {
+	keys := [][]byte{}
+	err := q.store.bolt.Update(func(tx *bolt.Tx) error {
+		err := dead(tx, limit, func(k []byte, letter *queue.DeadLetter) error {
+			keys = append(keys, append([]byte{}, k...))
+			return enqueue(tx, letter.Body, letter.Priority, 0, letter.Headers)
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Bucket(deadBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	q.notify()
+	return len(keys), nil
+}
+
+func (q *msgQueue) Purge() (int, error) {
+	n := 0
+	err := q.store.bolt.Update(func(tx *bolt.Tx) error {
+		n = tx.Bucket(deadBucket).Stats().KeyN
+		if err := tx.DeleteBucket(deadBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(deadBucket)
+		return err
+	})
+	return n, err
+}
+
+func (q *msgQueue) Pull() (queue.Delivery, error) {
+	for {
+		q.mu.Lock()
+		closed, pushed := q.closed, q.pushed
+		q.mu.Unlock()
+		if closed {
+			return nil, errors.New("queue has been closed")
+		}
+
+		d, err := q.pop()
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			return d, nil
+		}
+
+		q.mu.Lock()
+		// only wait if nothing was pushed since we looked
+		for q.pushed == pushed && !q.closed {
+			q.cond.Wait()
+		}
+		q.mu.Unlock()
+	}
+}
@@ -0,0 +1,136 @@
+package embedded
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+	bolt "go.etcd.io/bbolt"
+)
+
+type seedRow struct {
+	Seed    *seed.Seed `json:"seed"`
+	Removed bool       `json:"removed"`
+	Pages   int        `json:"pages"`
+	Added   time.Time  `json:"added"`
+}
+
+func getSeed(tx *bolt.Tx, url string) (*seedRow, error) {
+	v := tx.Bucket(seedBucket).Get([]byte(url))
+	if v == nil {
+		return nil, nil
+	}
+	row := &seedRow{}
+	if err := json.Unmarshal(v, row); err != nil {
+		return nil, err
+	}
+	row.Seed.Removed = row.Removed
+	if row.Seed.Scope != nil {
+		if err := row.Seed.Scope.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+func putSeed(tx *bolt.Tx, row *seedRow) error {
+	v, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(seedBucket).Put([]byte(row.Seed.Url), v)
+}
+
+func (d *db) SaveSeed(s *seed.Seed) error {
+	return d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		row, err := getSeed(tx, s.Url)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			row = &seedRow{Added: time.Now()}
+		}
+		row.Seed = s
+		row.Removed = false
+		return putSeed(tx, row)
+	})
+}
+
+func (d *db) Seed(url string) (*seed.Seed, error) {
+	var s *seed.Seed
+	err := d.store.bolt.View(func(tx *bolt.Tx) error {
+		row, err := getSeed(tx, url)
+		if row != nil {
+			s = row.Seed
+		}
+		return err
+	})
+	return s, err
+}
+
+func (d *db) Seeds() ([]*seed.Seed, error) {
+	rows := []*seedRow{}
+	err := d.store.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(seedBucket).ForEach(func(k, _ []byte) error {
+			row, err := getSeed(tx, string(k))
+			if err != nil {
+				return err
+			}
+			if !row.Removed {
+				rows = append(rows, row)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Added.Before(rows[j].Added) })
+
+	seeds := make([]*seed.Seed, len(rows))
+	for i, row := range rows {
+		seeds[i] = row.Seed
+	}
+	return seeds, nil
+}
+
+func (d *db) RemoveSeed(url string) (bool, error) {
+	removed := false
+	err := d.store.bolt.Update(func(tx *bolt.Tx) error {
+		row, err := getSeed(tx, url)
+		if err != nil || row == nil || row.Removed {
+			return err
+		}
+		row.Removed = true
+		removed = true
+		return putSeed(tx, row)
+	})
+	return removed, err
+}
+
+func (d *db) IncrSeed(url string) (int, error) {
+	pages := 0
+	err := d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		pages = 0
+		row, err := getSeed(tx, url)
+		if err != nil || row == nil {
+			return err
+		}
+		row.Pages++
+		pages = row.Pages
+		return putSeed(tx, row)
+	})
+	return pages, err
+}
+
+func (d *db) DecrSeed(url string) error {
+	return d.store.bolt.Batch(func(tx *bolt.Tx) error {
+		row, err := getSeed(tx, url)
+		if err != nil || row == nil || row.Pages == 0 {
+			return err
+		}
+		row.Pages--
+		return putSeed(tx, row)
+	})
+}
@@ -0,0 +1,88 @@
+package embedded
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	visitedBucket  = []byte("visited")
+	imageBucket    = []byte("image")
+	labelBucket    = []byte("label")
+	mappingBucket  = []byte("image_label_mapping")
+	cacheBucket    = []byte("cache")
+	queueBucket    = []byte("queue")
+	unackedBucket  = []byte("queue_unacked")
+	retriesBucket  = []byte("queue_retries")
+	headersBucket  = []byte("queue_headers")
+	deadBucket     = []byte("queue_dead")
+	metaBucket     = []byte("meta")
+	pageBucket     = []byte("page")
+	pageDueBucket  = []byte("page_due")
+	hostBucket     = []byte("host")
+	yieldBucket    = []byte("host_image")
+	seedBucket     = []byte("seed")
+	overflowBucket = []byte("overflow")
+	// the headers of spilled messages, keyed like them
+	overflowHeadersBucket = []byte("overflow_headers")
+)
+
+// store is a single bbolt file holding what Postgres, Redis and RabbitMQ
+// hold otherwise, for running the crawler standalone. The database, cache
+// and queue built on top of it share the file, closing them leaves it open.
+type store struct {
+	bolt *bolt.DB
+}
+
+func Open(path string) (*store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			visitedBucket,
+			imageBucket,
+			labelBucket,
+			mappingBucket,
+			cacheBucket,
+			queueBucket,
+			unackedBucket,
+			retriesBucket,
+			headersBucket,
+			deadBucket,
+			metaBucket,
+			pageBucket,
+			pageDueBucket,
+			hostBucket,
+			yieldBucket,
+			seedBucket,
+			overflowBucket,
+			overflowHeadersBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		// whatever the last run pulled without acknowledging is handed
+		// out again
+		return requeueUnacked(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &store{bolt: db}, nil
+}
+
+// ping fails once the file was closed.
+func (s *store) ping() error {
+	return s.bolt.View(func(tx *bolt.Tx) error { return nil })
+}
+
+func (s *store) Close() error {
+	return s.bolt.Close()
+}
@@ -0,0 +1,122 @@
+package faultproxy
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// proxy forwards tcp connections to a target and can cut them like
+// toxiproxy does, to test how adapters live through their backend going away.
+type proxy struct {
+	target string
+	ln     net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	down  bool
+}
+
+// New listens on a free local port and forwards to target.
+func New(target string) (*proxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &proxy{target: target, ln: ln, conns: map[net.Conn]bool{}}
+	go p.serve()
+	return p, nil
+}
+
+// HostPort returns where the proxy listens, split like the adapters take it.
+func (p *proxy) HostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(p.ln.Addr().String())
+	return host, port
+}
+
+func (p *proxy) serve() {
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.forward(client)
+	}
+}
+
+func (p *proxy) forward(client net.Conn) {
+	p.mu.Lock()
+	down := p.down
+	p.mu.Unlock()
+	if down {
+		client.Close()
+		return
+	}
+
+	server, err := net.Dial("tcp", p.target)
+	if err != nil {
+		client.Close()
+		return
+	}
+	if !p.track(client, server) {
+		return
+	}
+	defer p.untrack(client, server)
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go pipe(server, client)
+	go pipe(client, server)
+	<-done
+}
+
+// track remembers both ends so Cut can close them, unless the proxy went
+// down since the client connected.
+func (p *proxy) track(conns ...net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		for _, c := range conns {
+			c.Close()
+		}
+		return false
+	}
+	for _, c := range conns {
+		p.conns[c] = true
+	}
+	return true
+}
+
+func (p *proxy) untrack(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+		delete(p.conns, c)
+	}
+}
+
+// Cut drops every open connection and refuses new ones until Restore.
+func (p *proxy) Cut() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = true
+	for c := range p.conns {
+		c.Close()
+		delete(p.conns, c)
+	}
+}
+
+func (p *proxy) Restore() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = false
+}
+
+func (p *proxy) Close() error {
+	p.Cut()
+	return p.ln.Close()
+}
@@ -0,0 +1,87 @@
+package faultproxy
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func echo(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := c.Read(buf)
+					if err != nil {
+						return
+					}
+					c.Write(buf[:n])
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func roundTrip(c net.Conn) error {
+	c.SetDeadline(time.Now().Add(time.Second))
+	if _, err := c.Write([]byte("ping\n")); err != nil {
+		return err
+	}
+	_, err := bufio.NewReader(c).ReadString('\n')
+	return err
+}
+
+func TestProxy(t *testing.T) {
+	p, err := New(echo(t))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer p.Close()
+	host, port := p.HostPort()
+	addr := net.JoinHostPort(host, port)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	if err := roundTrip(c); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// open connections die and new ones don't get through
+	p.Cut()
+	if err := roundTrip(c); err == nil {
+		t.Error("connection survived the cut")
+	}
+	refused, err := net.Dial("tcp", addr)
+	if err == nil {
+		defer refused.Close()
+		if err := roundTrip(refused); err == nil {
+			t.Error("new connection got through while cut")
+		}
+	}
+
+	p.Restore()
+	c, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer c.Close()
+	if err := roundTrip(c); err != nil {
+		t.Errorf("connection after restore failed: %s", err.Error())
+	}
+}
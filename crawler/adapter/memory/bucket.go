@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+)
+
+type object struct {
+	body     []byte
+	modified time.Time
+}
+
+type buck struct {
+	mu      sync.Mutex
+	objects map[string]*object
+}
+
+func NewBucket() *buck {
+	return &buck{objects: map[string]*object{}}
+}
+
+func (b *buck) Put(key string, body []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = &object{body: append([]byte{}, body...), modified: time.Now()}
+	return nil
+}
+
+func (b *buck) Get(key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, bucket.ErrNotFound
+	}
+	return append([]byte{}, obj.body...), nil
+}
+
+func (b *buck) Exists(key string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.objects[key]
+	return ok, nil
+}
+
+func (b *buck) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, key)
+	return nil
+}
+
+// List walks a snapshot in key order, fn may write to the bucket meanwhile.
+func (b *buck) List(prefix string, fn func(key string) error) error {
+	b.mu.Lock()
+	keys := []string{}
+	for k := range b.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	b.mu.Unlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := fn(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *buck) Stat(key string) (*bucket.Info, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, bucket.ErrNotFound
+	}
+	return &bucket.Info{Key: key, Size: int64(len(obj.body)), Modified: obj.modified}, nil
+}
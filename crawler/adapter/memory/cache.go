@@ -0,0 +1,33 @@
+package memory
+
+import "sync"
+
+type cache struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func NewCache() *cache {
+	return &cache{keys: map[string]bool{}}
+}
+
+func (c *cache) Close() error {
+	return nil
+}
+
+func (c *cache) Ping() error {
+	return nil
+}
+
+func (c *cache) Exist(hash string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[hash], nil
+}
+
+func (c *cache) Set(hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[hash] = true
+	return nil
+}
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+)
+
+func (d *db) Image(hash string) (*database.ImageInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	info, ok := d.infos[hash]
+	if !ok {
+		return nil, nil
+	}
+	cp := *info
+	return &cp, nil
+}
+
+func (d *db) ImageLabels(hash string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	labels := []string{}
+	for m := range d.mappings {
+		if m.img == hash {
+			labels = append(labels, d.labels[m.lbl])
+		}
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+// newer orders images the way FindImages returns them.
+func newer(a, b *database.ImageInfo) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.Hash > b.Hash
+}
+
+func passes(info *database.ImageInfo, f *database.ImageFilter) bool {
+	switch {
+	case len(f.Format) > 0 && info.Format != f.Format,
+		f.MinWidth > 0 && info.Width < f.MinWidth,
+		f.MaxWidth > 0 && info.Width > f.MaxWidth,
+		f.MinHeight > 0 && info.Height < f.MinHeight,
+		f.MaxHeight > 0 && info.Height > f.MaxHeight,
+		f.MinEntropy > 0 && info.Entropy < f.MinEntropy,
+		f.MaxEntropy > 0 && info.Entropy > f.MaxEntropy,
+		!f.Since.IsZero() && info.CreatedAt.Before(f.Since),
+		!f.Until.IsZero() && !info.CreatedAt.Before(f.Until):
+		return false
+	}
+	if f.After != nil {
+		after := &database.ImageInfo{CreatedAt: f.After.CreatedAt, Hash: f.After.Hash}
+		return newer(after, info)
+	}
+	return true
+}
+
+func (d *db) FindImages(f *database.ImageFilter) ([]*database.ImageInfo, error) {
+	d.mu.Lock()
+	images := []*database.ImageInfo{}
+	for _, info := range d.infos {
+		if passes(info, f) {
+			cp := *info
+			images = append(images, &cp)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Slice(images, func(i, j int) bool { return newer(images[i], images[j]) })
+	if len(images) > f.Limit {
+		images = images[:f.Limit]
+	}
+	return images, nil
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchLabels matches labels that have every word of query, none of the
+// search syntax Postgres understands. The rank is the share of the words of
+// the label that matched.
+func (d *db) SearchLabels(query string, limit, offset int) ([]*database.LabelMatch, error) {
+	want := words(query)
+	if len(want) < 1 {
+		return []*database.LabelMatch{}, nil
+	}
+
+	d.mu.Lock()
+	matches := []*database.LabelMatch{}
+	for m := range d.mappings {
+		label := d.labels[m.lbl]
+		have := map[string]bool{}
+		for _, w := range words(label) {
+			have[w] = true
+		}
+		all := true
+		for _, w := range want {
+			all = all && have[w]
+		}
+		if !all {
+			continue
+		}
+		info := *d.infos[m.img]
+		matches = append(matches, &database.LabelMatch{
+			Image: &info,
+			Label: label,
+			Rank:  float64(len(want)) / float64(len(have)),
+		})
+	}
+	d.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank > matches[j].Rank
+		}
+		return newer(matches[i].Image, matches[j].Image)
+	})
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
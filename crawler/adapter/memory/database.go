@@ -0,0 +1,518 @@
+package memory
+
+import (
+	"errors"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+)
+
+type mapping struct {
+	img string
+	lbl string
+}
+
+type db struct {
+	mu       sync.Mutex
+	visited  map[string]bool
+	images   map[string]*database.ImageRecord
+	infos    map[string]*database.ImageInfo
+	labels   map[string]string
+	mappings map[mapping]bool
+	pages    map[string]page.Page
+	hosts    map[string]int
+	yields   map[string]int
+	seeds    map[string]*seedRow
+	added    int
+	overflow []*database.Spilled
+	spilled  int64
+}
+
+type seedRow struct {
+	seed  seed.Seed
+	pages int
+	added int
+}
+
+func NewDatabase() *db {
+	return &db{
+		visited:  map[string]bool{},
+		images:   map[string]*database.ImageRecord{},
+		infos:    map[string]*database.ImageInfo{},
+		labels:   map[string]string{},
+		mappings: map[mapping]bool{},
+		pages:    map[string]page.Page{},
+		hosts:    map[string]int{},
+		yields:   map[string]int{},
+		seeds:    map[string]*seedRow{},
+	}
+}
+
+func (d *db) Close() {}
+
+func (d *db) Ping() error {
+	return nil
+}
+
+func (d *db) InsertUrl(hash string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.visited[hash] {
+		return false, nil
+	}
+	d.visited[hash] = true
+	return true, nil
+}
+
+func (d *db) ExistUrl(hash string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.visited[hash], nil
+}
+
+func (d *db) DeleteUrl(hash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.visited, hash)
+	return nil
+}
+
+func (d *db) Urls(fn func(hash string) error) error {
+	d.mu.Lock()
+	hashes := make([]string, 0, len(d.visited))
+	for hash := range d.visited {
+		hashes = append(hashes, hash)
+	}
+	d.mu.Unlock()
+
+	for _, hash := range hashes {
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *db) IncrHost(host string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hosts[host]++
+	return d.hosts[host], nil
+}
+
+func (d *db) DecrHost(host string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hosts[host] > 0 {
+		d.hosts[host]--
+	}
+	return nil
+}
+
+func (d *db) IncrHostImages(host string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.yields[host]++
+	return d.yields[host], nil
+}
+
+func (d *db) HostImages(host string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.yields[host], nil
+}
+
+func (d *db) insertImage(info *database.ImageInfo) bool {
+	if _, ok := d.images[info.Hash]; ok {
+		return false
+	}
+	d.images[info.Hash] = &database.ImageRecord{Hash: info.Hash, Format: info.Format, Url: info.Url}
+	stored := *info
+	stored.CreatedAt = time.Now()
+	d.infos[info.Hash] = &stored
+	return true
+}
+
+func (d *db) insertLabel(hash, label string) bool {
+	if _, ok := d.labels[hash]; ok {
+		return false
+	}
+	d.labels[hash] = label
+	return true
+}
+
+// insertMapping enforces the foreign keys of image_label_mapping.
+func (d *db) insertMapping(imgHash, lblHash string) (bool, error) {
+	if _, ok := d.images[imgHash]; !ok {
+		return false, errors.New("image doesn't exist")
+	}
+	if _, ok := d.labels[lblHash]; !ok {
+		return false, errors.New("label doesn't exist")
+	}
+	m := mapping{img: imgHash, lbl: lblHash}
+	if d.mappings[m] {
+		return false, nil
+	}
+	d.mappings[m] = true
+	return true, nil
+}
+
+func (d *db) InsertImage(info *database.ImageInfo) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.insertImage(info), nil
+}
+
+func (d *db) InsertLabel(hash, label string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.insertLabel(hash, label), nil
+}
+
+func (d *db) InsertMapping(imgHash, lblHash string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.insertMapping(imgHash, lblHash)
+}
+
+func (d *db) ExistImage(hash string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.images[hash]
+	return ok, nil
+}
+
+func (d *db) Images(fn func(rec *database.ImageRecord) error) error {
+	d.mu.Lock()
+	recs := make([]*database.ImageRecord, 0, len(d.images))
+	for _, rec := range d.images {
+		labeled := false
+		for m := range d.mappings {
+			if m.img == rec.Hash {
+				labeled = true
+				break
+			}
+		}
+		recs = append(recs, &database.ImageRecord{
+			Hash:    rec.Hash,
+			Format:  rec.Format,
+			Url:     rec.Url,
+			Labeled: labeled,
+		})
+	}
+	d.mu.Unlock()
+
+	for _, rec := range recs {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *db) DeleteImage(hash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for m := range d.mappings {
+		if m.img == hash {
+			delete(d.mappings, m)
+		}
+	}
+	delete(d.images, hash)
+	delete(d.infos, hash)
+	return nil
+}
+
+func (d *db) Page(hash string) (*page.Page, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.pages[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (d *db) SavePage(p *page.Page) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pages[p.Hash] = *p
+	return nil
+}
+
+func (d *db) ClaimPages(now time.Time, lease time.Duration, limit int) ([]*page.Page, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	due := []*page.Page{}
+	for _, p := range d.pages {
+		if !p.NextFetch.After(now) {
+			p := p
+			due = append(due, &p)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextFetch.Before(due[j].NextFetch) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, p := range due {
+		p.NextFetch = now.Add(lease)
+		d.pages[p.Hash] = *p
+	}
+	return due, nil
+}
+
+func (d *db) SaveSeed(s *seed.Seed) error {
+	saved := *s
+	saved.Removed = false
+	if s.Scope != nil {
+		// like the other stores, keep a copy that comes back compiled
+		sc := *s.Scope
+		if err := sc.Compile(); err != nil {
+			return err
+		}
+		saved.Scope = &sc
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row, ok := d.seeds[s.Url]
+	if !ok {
+		d.added++
+		row = &seedRow{added: d.added}
+		d.seeds[s.Url] = row
+	}
+	row.seed = saved
+	return nil
+}
+
+func (d *db) Seed(url string) (*seed.Seed, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row, ok := d.seeds[url]
+	if !ok {
+		return nil, nil
+	}
+	s := row.seed
+	return &s, nil
+}
+
+func (d *db) Seeds() ([]*seed.Seed, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rows := []*seedRow{}
+	for _, row := range d.seeds {
+		if !row.seed.Removed {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].added < rows[j].added })
+
+	seeds := make([]*seed.Seed, len(rows))
+	for i, row := range rows {
+		s := row.seed
+		seeds[i] = &s
+	}
+	return seeds, nil
+}
+
+func (d *db) RemoveSeed(url string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row, ok := d.seeds[url]
+	if !ok || row.seed.Removed {
+		return false, nil
+	}
+	row.seed.Removed = true
+	return true, nil
+}
+
+func (d *db) IncrSeed(url string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row, ok := d.seeds[url]
+	if !ok {
+		return 0, nil
+	}
+	row.pages++
+	return row.pages, nil
+}
+
+func (d *db) DecrSeed(url string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if row, ok := d.seeds[url]; ok && row.pages > 0 {
+		row.pages--
+	}
+	return nil
+}
+
+func (d *db) Spill(msg []byte, priority uint8, headers map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.spilled++
+	d.overflow = append(d.overflow, &database.Spilled{
+		Id:       d.spilled,
+		Msg:      append([]byte{}, msg...),
+		Priority: priority,
+		Headers:  maps.Clone(headers),
+	})
+	return nil
+}
+
+func (d *db) Spilled(limit int) ([]*database.Spilled, error) {
+	d.mu.Lock()
+	spilled := make([]*database.Spilled, len(d.overflow))
+	for i, s := range d.overflow {
+		c := *s
+		spilled[i] = &c
+	}
+	d.mu.Unlock()
+
+	sort.SliceStable(spilled, func(i, j int) bool { return spilled[i].Priority > spilled[j].Priority })
+	if len(spilled) > limit {
+		spilled = spilled[:limit]
+	}
+	return spilled, nil
+}
+
+func (d *db) Unspill(id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, s := range d.overflow {
+		if s.Id == id {
+			d.overflow = append(d.overflow[:i], d.overflow[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// tx buffers its writes and applies them all at once on Commit, so others
+// never see a partial transaction.
+type tx struct {
+	db       *db
+	images   map[string]bool
+	labels   map[string]bool
+	mappings map[mapping]bool
+	ops      []func() error
+	closed   bool
+}
+
+func (d *db) Begin() (database.Tx, error) {
+	return &tx{
+		db:       d,
+		images:   map[string]bool{},
+		labels:   map[string]bool{},
+		mappings: map[mapping]bool{},
+	}, nil
+}
+
+func (t *tx) InsertImage(info *database.ImageInfo) (bool, error) {
+	if t.closed {
+		return false, errors.New("transaction already closed")
+	}
+	t.db.mu.Lock()
+	_, exist := t.db.images[info.Hash]
+	t.db.mu.Unlock()
+	if exist || t.images[info.Hash] {
+		return false, nil
+	}
+	t.images[info.Hash] = true
+	t.ops = append(t.ops, func() error {
+		t.db.insertImage(info)
+		return nil
+	})
+	return true, nil
+}
+
+func (t *tx) InsertLabel(hash, label string) (bool, error) {
+	if t.closed {
+		return false, errors.New("transaction already closed")
+	}
+	t.db.mu.Lock()
+	_, exist := t.db.labels[hash]
+	t.db.mu.Unlock()
+	if exist || t.labels[hash] {
+		return false, nil
+	}
+	t.labels[hash] = true
+	t.ops = append(t.ops, func() error {
+		t.db.insertLabel(hash, label)
+		return nil
+	})
+	return true, nil
+}
+
+func (t *tx) InsertMapping(imgHash, lblHash string) (bool, error) {
+	if t.closed {
+		return false, errors.New("transaction already closed")
+	}
+	m := mapping{img: imgHash, lbl: lblHash}
+	t.db.mu.Lock()
+	_, img := t.db.images[imgHash]
+	_, lbl := t.db.labels[lblHash]
+	exist := t.db.mappings[m]
+	t.db.mu.Unlock()
+	if !img && !t.images[imgHash] {
+		return false, errors.New("image doesn't exist")
+	}
+	if !lbl && !t.labels[lblHash] {
+		return false, errors.New("label doesn't exist")
+	}
+	if exist || t.mappings[m] {
+		return false, nil
+	}
+	t.mappings[m] = true
+	t.ops = append(t.ops, func() error {
+		_, err := t.db.insertMapping(imgHash, lblHash)
+		return err
+	})
+	return true, nil
+}
+
+func (t *tx) Commit() error {
+	if t.closed {
+		return errors.New("transaction already closed")
+	}
+	t.closed = true
+
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	// an image could have been deleted since it was mapped, apply to copies
+	// so a failing statement leaves no trace
+	images, labels, mappings := t.db.images, t.db.labels, t.db.mappings
+	t.db.images = copyMap(images)
+	t.db.labels = copyMap(labels)
+	t.db.mappings = copyMap(mappings)
+	for _, op := range t.ops {
+		if err := op(); err != nil {
+			t.db.images, t.db.labels, t.db.mappings = images, labels, mappings
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	if t.closed {
+		return errors.New("transaction already closed")
+	}
+	t.closed = true
+	t.ops = nil
+	return nil
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
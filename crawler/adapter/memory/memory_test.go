@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket/buckettest"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache/cachetest"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database/databasetest"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue/queuetest"
+)
+
+func TestDatabase(t *testing.T) {
+	databasetest.Run(t, NewDatabase())
+}
+
+func TestCatalog(t *testing.T) {
+	databasetest.RunCatalog(t, NewDatabase())
+}
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, NewCache())
+}
+
+func TestQueue(t *testing.T) {
+	queuetest.Run(t, func(maxSize int) (queue.Queue, error) {
+		return NewQueue(maxSize), nil
+	})
+
+	// unlike a broker with a consumer attached, nothing is taken out while
+	// pushing, so the overflow is refused deterministically
+	q := NewQueue(2)
+	for _, msg := range []string{"a", "b"} {
+		if err := q.Push([]byte(msg), 0, nil); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := q.Push([]byte("c"), 0, nil); err != queue.ErrFull {
+		t.Errorf("got error: %v, want: %v", err, queue.ErrFull)
+	}
+	if _, err := q.Pull(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := q.Push([]byte("d"), 0, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, want := range []string{"b", "d"} {
+		d, err := q.Pull()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(d.Body()) != want {
+			t.Errorf("got message: %s, want: %s", string(d.Body()), want)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	buckettest.Run(t, NewBucket())
+}
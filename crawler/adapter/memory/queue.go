@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/priority"
+)
+
+// msgQueue behaves like the RabbitMQ queue: messages are handed out by
+// priority, in the order they were pushed within one, and once maxSize
+// messages are waiting, new ones are refused like x-overflow "reject-publish"
+// does. A nacked message goes to the back of its priority until it ran out of
+// retries.
+type msgQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	msgs    [priority.Max + 1][]*entry
+	len     int
+	dead    []*queue.DeadLetter
+	maxSize int
+	closed  bool
+}
+
+type entry struct {
+	body    []byte
+	headers map[string]string
+	retries int
+}
+
+func NewQueue(maxSize int) *msgQueue {
+	q := &msgQueue{maxSize: maxSize}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *msgQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *msgQueue) Ping() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("queue has been closed")
+	}
+	return nil
+}
+
+func (q *msgQueue) push(e *entry, prio uint8) {
+	prio = min(prio, priority.Max)
+	q.msgs[prio] = append(q.msgs[prio], e)
+	q.len++
+	q.cond.Signal()
+}
+
+func (q *msgQueue) Push(msg []byte, prio uint8, headers map[string]string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("queue has been closed")
+	}
+	if q.maxSize > 0 && q.len >= q.maxSize {
+		return queue.ErrFull
+	}
+	q.push(&entry{body: append([]byte{}, msg...), headers: maps.Clone(headers)}, prio)
+	return nil
+}
+
+func (q *msgQueue) Pull() (queue.Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.len < 1 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, errors.New("queue has been closed")
+	}
+	for prio := priority.Max; ; prio-- {
+		if len(q.msgs[prio]) > 0 {
+			e := q.msgs[prio][0]
+			q.msgs[prio] = q.msgs[prio][1:]
+			q.len--
+			return &delivery{queue: q, entry: e, prio: uint8(prio)}, nil
+		}
+	}
+}
+
+func (q *msgQueue) Len() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.len, nil
+}
+
+func (q *msgQueue) DeadLetters(limit int) ([]*queue.DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.dead)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	letters := make([]*queue.DeadLetter, n)
+	for i := range letters {
+		letter := *q.dead[i]
+		letters[i] = &letter
+	}
+	return letters, nil
+}
+
+func (q *msgQueue) Requeue(limit int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.dead)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	for _, letter := range q.dead[:n] {
+		q.push(&entry{body: letter.Body, headers: letter.Headers}, letter.Priority)
+	}
+	q.dead = q.dead[n:]
+	return n, nil
+}
+
+func (q *msgQueue) Purge() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.dead)
+	q.dead = nil
+	return n, nil
+}
+
+type delivery struct {
+	queue *msgQueue
+	entry *entry
+	prio  uint8
+	done  bool
+}
+
+func (d *delivery) Body() []byte {
+	return d.entry.body
+}
+
+func (d *delivery) Headers() map[string]string {
+	return d.entry.headers
+}
+
+func (d *delivery) settle() error {
+	if d.done {
+		return errors.New("delivery already acknowledged")
+	}
+	d.done = true
+	return nil
+}
+
+func (d *delivery) Ack() error {
+	d.queue.mu.Lock()
+	defer d.queue.mu.Unlock()
+	return d.settle()
+}
+
+func (d *delivery) Nack(requeue bool) error {
+	if !requeue {
+		return d.Reject("rejected")
+	}
+	if d.entry.retries+1 > queue.MaxRetries {
+		return d.Reject("too many retries")
+	}
+	q := d.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := d.settle(); err != nil {
+		return err
+	}
+	q.push(&entry{body: d.entry.body, headers: d.entry.headers, retries: d.entry.retries + 1}, d.prio)
+	return nil
+}
+
+func (d *delivery) Reject(reason string) error {
+	q := d.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := d.settle(); err != nil {
+		return err
+	}
+	q.dead = append(q.dead, &queue.DeadLetter{
+		Body:     d.entry.body,
+		Priority: d.prio,
+		Headers:  d.entry.headers,
+		Reason:   reason,
+		Retries:  d.entry.retries,
+		DeadAt:   time.Now(),
+	})
+	return nil
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the crawler next to the Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	Tasks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_tasks_total",
+		Help: "Tasks taken from the queue by what came of them.",
+	}, []string{"outcome"})
+	PagesFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_pages_fetched_total",
+		Help: "HTML pages downloaded.",
+	})
+	ImagesDiscovered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_images_discovered_total",
+		Help: "Image urls queued for the first time.",
+	})
+	ImagesAccepted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_images_accepted_total",
+		Help: "Images stored.",
+	})
+	ImagesRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_images_rejected_total",
+		Help: "Images downloaded but not stored by why.",
+	}, []string{"reason"})
+	BytesDownloaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_downloaded_bytes_total",
+		Help: "Response bodies downloaded.",
+	})
+	FetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crawler_fetch_duration_seconds",
+		Help:    "Time to download a url by the class of its status.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"status_class"})
+	InFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crawler_in_flight_requests",
+		Help: "Requests waiting for a response by host.",
+	}, []string{"host"})
+	StoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crawler_store_duration_seconds",
+		Help:    "Time of database, cache and bucket operations.",
+		Buckets: prometheus.ExponentialBuckets(.0005, 4, 8),
+	}, []string{"store", "op"})
+	StoreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_store_errors_total",
+		Help: "Failed database, cache and bucket operations.",
+	}, []string{"store", "op"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Tasks,
+		PagesFetched,
+		ImagesDiscovered,
+		ImagesAccepted,
+		ImagesRejected,
+		BytesDownloaded,
+		FetchDuration,
+		InFlight,
+		StoreDuration,
+		StoreErrors,
+	)
+}
+
+// QueueDepth reports the messages waiting in the queue as len returns them
+// on every scrape.
+func QueueDepth(len func() (int, error)) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "crawler_queue_depth",
+		Help: "Messages waiting in the queue, -1 if it can't be asked.",
+	}, func() float64 {
+		n, err := len()
+		if err != nil {
+			return -1
+		}
+		return float64(n)
+	}))
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Measure records an operation on store that started at start.
+func Measure(store, op string, start time.Time, err error) {
+	StoreDuration.WithLabelValues(store, op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StoreErrors.WithLabelValues(store, op).Inc()
+	}
+}
+
+// StatusClass is 2xx to 5xx for a status, error without a response.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "error"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+var (
+	inFlightMu sync.Mutex
+	inFlight   = map[string]int{}
+)
+
+// Request counts a request to host as in flight until the returned function
+// is called. A host without requests left is dropped from the gauge, so it
+// doesn't keep a series for every host ever crawled.
+func Request(host string) func() {
+	inFlightMu.Lock()
+	inFlight[host]++
+	InFlight.WithLabelValues(host).Inc()
+	inFlightMu.Unlock()
+
+	return func() {
+		inFlightMu.Lock()
+		defer inFlightMu.Unlock()
+		inFlight[host]--
+		if inFlight[host] > 0 {
+			InFlight.WithLabelValues(host).Dec()
+			return
+		}
+		delete(inFlight, host)
+		InFlight.DeleteLabelValues(host)
+	}
+}
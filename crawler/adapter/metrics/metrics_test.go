@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatusClass(t *testing.T) {
+	for status, want := range map[int]string{
+		0:   "error",
+		200: "2xx",
+		304: "3xx",
+		404: "4xx",
+		503: "5xx",
+		600: "error",
+	} {
+		if got := StatusClass(status); got != want {
+			t.Errorf("got class: %s, for status: %d, want: %s", got, status, want)
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	first := Request("example.com")
+	second := Request("example.com")
+	if got := testutil.ToFloat64(InFlight.WithLabelValues("example.com")); got != 2 {
+		t.Errorf("got in flight: %f, want: 2", got)
+	}
+	first()
+	if got := testutil.ToFloat64(InFlight.WithLabelValues("example.com")); got != 1 {
+		t.Errorf("got in flight: %f, want: 1", got)
+	}
+	second()
+	// a host without requests has no series left
+	if n := testutil.CollectAndCount(InFlight); n != 0 {
+		t.Errorf("got series: %d, want: 0", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	Measure("database", "insert_url", time.Now(), nil)
+	Measure("database", "insert_url", time.Now(), io.EOF)
+	if err := QueueDepth(func() (int, error) { return 42, nil }); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`crawler_store_duration_seconds_count{op="insert_url",store="database"} 2`,
+		`crawler_store_errors_total{op="insert_url",store="database"} 1`,
+		"crawler_queue_depth 42",
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing metric: %s", want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue/queuetest"
+)
+
+func TestConformance(t *testing.T) {
+	queuetest.Run(t, queue.Connect)
+}
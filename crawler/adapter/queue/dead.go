@@ -0,0 +1,153 @@
+package queue
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// declareDead declares the exchange name.dlx and the queue name.dead bound
+// to it. Besides what Reject sends there, RabbitMQ routes messages nacked
+// without requeue there on its own.
+func declareDead(ch *amqp.Channel, name string) error {
+	err := ch.ExchangeDeclare(
+		name+".dlx", // name
+		"fanout",    // type
+		true,        // durable
+		false,       // auto-deleted
+		false,       // internal
+		false,       // no-wait
+		nil,         // arguments
+	)
+	if err != nil {
+		return err
+	}
+	_, err = ch.QueueDeclare(
+		name+".dead", // name
+		true,         // durable
+		false,        // delete when unused
+		false,        // exclusive
+		false,        // no-wait
+		nil,          // arguments
+	)
+	if err != nil {
+		return err
+	}
+	return ch.QueueBind(name+".dead", "", name+".dlx", false, nil)
+}
+
+// headers returns the headers of t Push was given, without the ones kept
+// for the retries and dead letters.
+func headers(t amqp.Table) map[string]string {
+	h := map[string]string{}
+	for k, v := range t {
+		if s, ok := v.(string); ok && k != retriesHeader && k != reasonHeader {
+			h[k] = s
+		}
+	}
+	if len(h) < 1 {
+		return nil
+	}
+	return h
+}
+
+func headerInt(v any) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+func deadLetter(msg *amqp.Delivery) *DeadLetter {
+	reason, _ := msg.Headers[reasonHeader].(string)
+	if len(reason) < 1 {
+		// dead-lettered by RabbitMQ itself
+		reason = "rejected"
+	}
+	return &DeadLetter{
+		Body:     msg.Body,
+		Priority: msg.Priority,
+		Headers:  headers(msg.Headers),
+		Reason:   reason,
+		Retries:  headerInt(msg.Headers[retriesHeader]),
+		DeadAt:   msg.Timestamp,
+	}
+}
+
+// dead gets up to limit dead letters on a channel of their own and calls fn
+// with each. Whatever fn doesn't ack goes back when the channel closes.
+func (q *queue) dead(limit int, fn func(msg *amqp.Delivery) error) error {
+	sess, err := q.current()
+	if err != nil {
+		return err
+	}
+	ch, err := sess.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for n := 0; limit < 1 || n < limit; n++ {
+		msg, ok, err := ch.Get(q.name+".dead", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *queue) DeadLetters(limit int) ([]*DeadLetter, error) {
+	letters := []*DeadLetter{}
+	err := q.dead(limit, func(msg *amqp.Delivery) error {
+		letters = append(letters, deadLetter(msg))
+		return nil
+	})
+	return letters, err
+}
+
+func (q *queue) Requeue(limit int) (int, error) {
+	n := 0
+	err := q.dead(limit, func(msg *amqp.Delivery) error {
+		if err := q.Push(msg.Body, msg.Priority, headers(msg.Headers)); err != nil {
+			return err
+		}
+		n++
+		return msg.Ack(false)
+	})
+	return n, err
+}
+
+// Len asks on a channel of its own, a failed passive declare closes it.
+func (q *queue) Len() (int, error) {
+	sess, err := q.current()
+	if err != nil {
+		return 0, err
+	}
+	ch, err := sess.conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+	state, err := ch.QueueDeclarePassive(q.name, true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return state.Messages, nil
+}
+
+func (q *queue) Purge() (int, error) {
+	sess, err := q.current()
+	if err != nil {
+		return 0, err
+	}
+	return sess.prod.QueuePurge(q.name+".dead", false)
+}
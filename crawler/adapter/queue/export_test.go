@@ -0,0 +1,11 @@
+package queue
+
+import "fmt"
+
+var queues = 0
+
+// Connect declares a new queue on the test container.
+func Connect(maxSize int) (Queue, error) {
+	queues++
+	return New(&Config{Host: host}, fmt.Sprintf("conformance-%d", queues), maxSize, 1)
+}
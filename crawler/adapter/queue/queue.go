@@ -3,115 +3,301 @@ package queue
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log/slog"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type Queue interface {
 	Close() error
-	Push(msg []byte) error
-	Pull() ([]byte, error)
+	// Ping fails while the queue can't be pushed to or pulled from.
+	Ping() error
+	// Push queues msg, messages with a higher priority up to priority.Max
+	// are pulled first. It fails with ErrFull while the queue is at its
+	// maximum size. The headers stay with msg through retries and dead
+	// letters.
+	Push(msg []byte, priority uint8, headers map[string]string) error
+	// Pull blocks until a message is ready. It stays on the queue until its
+	// delivery is acknowledged and comes back if the consumer dies first.
+	Pull() (Delivery, error)
+	// Len is how many messages wait to be pulled, not counting those pulled
+	// and not yet acknowledged.
+	Len() (int, error)
+	// DeadLetters returns up to limit dead letters without taking them out,
+	// all of them for a limit of 0.
+	DeadLetters(limit int) ([]*DeadLetter, error)
+	// Requeue pushes up to limit dead letters back onto the queue with their
+	// retries reset, all of them for a limit of 0.
+	Requeue(limit int) (int, error)
+	// Purge drops every dead letter.
+	Purge() (int, error)
 }
 
+type Delivery interface {
+	Body() []byte
+	Headers() map[string]string
+	Ack() error
+	// Nack puts the message back at the end of the queue for another try,
+	// past MaxRetries or without requeue it is dead-lettered.
+	Nack(requeue bool) error
+	// Reject dead-letters the message for reason, for messages no retry
+	// would help.
+	Reject(reason string) error
+}
+
+// ErrFull is returned by Push for a message the queue has no room for.
+var ErrFull = errors.New("queue is full")
+
+// ErrIncompatible is returned by New for a queue an older version declared
+// otherwise, Upgrade moves it over.
+var ErrIncompatible = errors.New("queue was declared otherwise before, run upgrade-queue")
+
+// MaxRetries is how often a message is given back before it is
+// dead-lettered.
+const MaxRetries = 3
+
+// DeadLetter is a message that was given up on and why.
+type DeadLetter struct {
+	Body     []byte            `json:"body"`
+	Priority uint8             `json:"priority"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Reason   string            `json:"reason"`
+	Retries  int               `json:"retries"`
+	DeadAt   time.Time         `json:"dead_at"`
+}
+
+const (
+	retriesHeader = "x-retries"
+	reasonHeader  = "x-reason"
+)
+
 type queue struct {
-	conn *amqp.Connection
-	name string
-	prod *amqp.Channel
-	cons *amqp.Channel
-	msgs <-chan amqp.Delivery
+	url      string
+	config   amqp.Config
+	name     string
+	maxSize  int
+	prefetch int
+
+	mu      sync.Mutex
+	session *session
+	ready   chan struct{} // closed while session is alive
+	closed  bool
+	done    chan struct{}
 }
 
-func New(host, port, name string, maxSize int) (*queue, error) {
-	conn, err := amqp.Dial(fmt.Sprintf("amqp://guest:guest@%s:%s/", host, port))
-	if err != nil {
-		return nil, err
-	}
+var errClosed = errors.New("queue has been closed")
 
-	prod, err := conn.Channel()
+// New declares the durable queue name and the queue name.dead its dead
+// letters are routed to through the exchange name.dlx. At most prefetch
+// messages are pulled and not yet acknowledged at a time, RabbitMQ keeps the
+// rest to hand out by priority. A lost connection is dialed again in the
+// background, until then Push and Pull wait.
+func New(cfg *Config, name string, maxSize, prefetch int) (*queue, error) {
+	url, config, err := cfg.dialConfig()
 	if err != nil {
 		return nil, err
 	}
-	var args amqp.Table = nil
-	if maxSize > 0 {
-		args = amqp.Table{
-			"x-max-length": maxSize, // Maximum messages
-			"x-overflow":   "reject-publish",
-		}
+	q := &queue{
+		url:      url,
+		config:   config,
+		name:     name,
+		maxSize:  maxSize,
+		prefetch: max(prefetch, 1),
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
 	}
-	_, err = prod.QueueDeclare(
-		name,  // name
-		false, // durable
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		args,
-	)
+	sess, err := q.dial()
 	if err != nil {
 		return nil, err
 	}
+	q.session = sess
+	close(q.ready)
+	go q.keepAlive(sess)
+	return q, nil
+}
 
-	cons, err := conn.Channel()
-	if err != nil {
-		return nil, err
+// current waits for a live session.
+func (q *queue) current() (*session, error) {
+	q.mu.Lock()
+	sess, ready := q.session, q.ready
+	q.mu.Unlock()
+	select {
+	case <-ready:
+		return sess, nil
+	case <-q.done:
+		return nil, errClosed
 	}
-	msgs, err := cons.Consume(
-		name,  // queue name
-		"",    // consumer tag
-		true,  // auto-ack
-		false, // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,   // arguments
-	)
-	if err != nil {
-		return nil, err
+}
+
+func (q *queue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
 	}
+	q.closed = true
+	close(q.done)
+	sess := q.session
+	q.mu.Unlock()
+	return sess.close()
+}
 
-	return &queue{
-		conn: conn,
-		prod: prod,
-		cons: cons,
-		msgs: msgs,
-		name: name,
-	}, nil
+// Ping doesn't wait for a lost connection to come back.
+func (q *queue) Ping() error {
+	q.mu.Lock()
+	sess, ready, closed := q.session, q.ready, q.closed
+	q.mu.Unlock()
+	if closed {
+		return errClosed
+	}
+	select {
+	case <-ready:
+	default:
+		return errors.New("not connected, reconnecting")
+	}
+	if sess.prod.IsClosed() || sess.cons.IsClosed() {
+		return errors.New("channel closed, reconnecting")
+	}
+	return nil
 }
 
-func (q *queue) Close() error {
-	prodErr := q.prod.Close()
-	consErr := q.cons.Close()
-	connErr := q.conn.Close()
+// publish blocks while the connection is down and publishes once it is back.
+// It returns once RabbitMQ confirmed the message, ErrFull if it refused it.
+func (q *queue) publish(exchange string, msg []byte, priority uint8, headers amqp.Table) error {
+	for {
+		sess, err := q.current()
+		if err != nil {
+			return err
+		}
+		conf, err := sess.prod.PublishWithDeferredConfirmWithContext(
+			context.Background(),
+			exchange, // exchange
+			q.name,   // routing key
+			false,    // mandatory
+			false,    // immediate
+			amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Priority:     priority,
+				Headers:      headers,
+				Timestamp:    time.Now(),
+				Body:         msg,
+			})
+		if err == nil {
+			if conf.Wait() {
+				return nil
+			}
+			// pending confirms are nacked when the channel closes too
+			if !sess.prod.IsClosed() {
+				return ErrFull
+			}
+		} else if !errors.Is(err, amqp.ErrClosed) {
+			return err
+		}
+		if err := q.awaitNext(sess); err != nil {
+			return err
+		}
+	}
+}
+
+// awaitNext waits until sess was found dead, so current returns the next.
+func (q *queue) awaitNext(sess *session) error {
+	select {
+	case <-sess.dead:
+		return nil
+	case <-q.done:
+		return errClosed
+	}
+}
 
-	if prodErr != nil {
-		return prodErr
+func (q *queue) Push(msg []byte, priority uint8, headers map[string]string) error {
+	t := amqp.Table{}
+	for k, v := range headers {
+		t[k] = v
 	}
-	if consErr != nil {
-		return consErr
+	return q.publish("", msg, priority, t)
+}
+
+type delivery struct {
+	queue *queue
+	msg   amqp.Delivery
+}
+
+func (d *delivery) Body() []byte {
+	return d.msg.Body
+}
+
+func (d *delivery) Headers() map[string]string {
+	return headers(d.msg.Headers)
+}
+
+// republish is what the copy of the delivery is published with, its own
+// headers and the given ones.
+func (d *delivery) republish(set amqp.Table) amqp.Table {
+	t := amqp.Table{}
+	for k, v := range d.msg.Headers {
+		t[k] = v
 	}
-	if connErr != nil {
-		return connErr
+	for k, v := range set {
+		t[k] = v
 	}
+	return t
+}
 
-	return nil
+func (d *delivery) Ack() error {
+	return d.msg.Ack(false)
+}
+
+// Nack publishes a copy that counts the retry, RabbitMQ doesn't count
+// requeues of classic queues.
+func (d *delivery) Nack(requeue bool) error {
+	if !requeue {
+		return d.Reject("rejected")
+	}
+	retries := headerInt(d.msg.Headers[retriesHeader]) + 1
+	if retries > MaxRetries {
+		return d.Reject("too many retries")
+	}
+	err := d.queue.publish("", d.msg.Body, d.msg.Priority, d.republish(amqp.Table{retriesHeader: retries}))
+	if err != nil {
+		slog.Warn("republishing for a retry failed, requeueing without counting it",
+			"adapter", "queue", "queue", d.queue.name, "err", err)
+		return d.msg.Nack(false, true)
+	}
+	return d.msg.Ack(false)
 }
 
-func (q *queue) Push(msg []byte) error {
-	return q.prod.PublishWithContext(
-		context.Background(),
-		"",     // exchange
-		q.name, // routing key
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        msg,
-		})
+func (d *delivery) Reject(reason string) error {
+	err := d.queue.publish(d.queue.name+".dlx", d.msg.Body, d.msg.Priority, d.republish(amqp.Table{
+		retriesHeader: headerInt(d.msg.Headers[retriesHeader]),
+		reasonHeader:  reason,
+	}))
+	if err != nil {
+		// the dead letter exchange of the queue still takes it, only
+		// without the reason
+		slog.Warn("dead-lettering with the reason failed, rejecting without it",
+			"adapter", "queue", "queue", d.queue.name, "reason", reason, "err", err)
+		return d.msg.Nack(false, false)
+	}
+	return d.msg.Ack(false)
 }
 
-func (q *queue) Pull() ([]byte, error) {
-	msg, ok := <-q.msgs
-	if !ok {
-		return nil, errors.New("queue has been closed")
+// Pull waits out a lost connection. Deliveries pulled before it can't be
+// acknowledged anymore, RabbitMQ hands them out again.
+func (q *queue) Pull() (Delivery, error) {
+	for {
+		sess, err := q.current()
+		if err != nil {
+			return nil, err
+		}
+		msg, ok := <-sess.msgs
+		if ok {
+			return &delivery{queue: q, msg: msg}, nil
+		}
+		if err := q.awaitNext(sess); err != nil {
+			return nil, err
+		}
 	}
-	return msg.Body, nil
 }
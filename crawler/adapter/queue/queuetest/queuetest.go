@@ -0,0 +1,290 @@
+package queuetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/priority"
+)
+
+// Run checks that the queues returned by newQueue behave like every other
+// queue. Every call has to return a new, empty queue.
+func Run(t *testing.T, newQueue func(maxSize int) (queue.Queue, error)) {
+	t.Run("FIFO", func(t *testing.T) {
+		q, err := newQueue(0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer q.Close()
+
+		for i := 0; i < 10; i++ {
+			if err := q.Push([]byte(fmt.Sprintf("msg-%d", i)), 0, nil); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		// a broker may have handed one to the consumer already
+		n, err := q.Len()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n < 9 || n > 10 {
+			t.Errorf("got len: %d, want: 10", n)
+		}
+		for i := 0; i < 10; i++ {
+			msg := pull(t, q)
+			if want := fmt.Sprintf("msg-%d", i); msg != want {
+				t.Errorf("got message: %s, want: %s", msg, want)
+			}
+		}
+		n, err = q.Len()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n != 0 {
+			t.Errorf("got len: %d, want: 0", n)
+		}
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		q, err := newQueue(0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer q.Close()
+
+		// a consumer may hold the first message before the rest arrive, so
+		// it is the one that goes first anyway
+		pushes := []struct {
+			msg      string
+			priority uint8
+		}{
+			{"first", priority.Max},
+			{"low", 0},
+			{"high-a", 7},
+			{"mid", 3},
+			{"high-b", 7},
+		}
+		for _, p := range pushes {
+			if err := q.Push([]byte(p.msg), p.priority, nil); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		for _, want := range []string{"first", "high-a", "high-b", "mid", "low"} {
+			msg := pull(t, q)
+			if msg != want {
+				t.Errorf("got message: %s, want: %s", msg, want)
+			}
+		}
+	})
+
+	t.Run("MaxSize", func(t *testing.T) {
+		q, err := newQueue(3)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer q.Close()
+
+		// a full queue refuses new messages. A consumer may take messages
+		// out while we push, so all that is certain is that some are
+		// refused and the first ones arrive in order.
+		full := 0
+		for i := 0; i < 8; i++ {
+			err := q.Push([]byte(fmt.Sprintf("msg-%d", i)), 0, nil)
+			if errors.Is(err, queue.ErrFull) {
+				full++
+			} else if err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		if full < 1 {
+			t.Error("no message refused by a full queue")
+		}
+		for i := 0; i < 3; i++ {
+			msg := pull(t, q)
+			if want := fmt.Sprintf("msg-%d", i); msg != want {
+				t.Errorf("got message: %s, want: %s", msg, want)
+			}
+		}
+	})
+
+	t.Run("Ack", func(t *testing.T) {
+		q, err := newQueue(0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer q.Close()
+
+		for _, msg := range []string{"a", "b"} {
+			if err := q.Push([]byte(msg), 0, nil); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+
+		// a message given back comes again after the others
+		d, err := q.Pull()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := d.Nack(true); err != nil {
+			t.Fatal(err.Error())
+		}
+		for _, want := range []string{"b", "a"} {
+			if msg := pull(t, q); msg != want {
+				t.Errorf("got message: %s, want: %s", msg, want)
+			}
+		}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		q, err := newQueue(0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer q.Close()
+
+		// the trace context of a message has to survive every way back
+		headers := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+		for _, msg := range []string{"poison", "flaky"} {
+			if err := q.Push([]byte(msg), 1, headers); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		d, err := q.Pull()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := d.Reject("malformed"); err != nil {
+			t.Fatal(err.Error())
+		}
+		// flaky comes back until it ran out of retries
+		for i := 0; i <= queue.MaxRetries; i++ {
+			d, err := q.Pull()
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if string(d.Body()) != "flaky" {
+				t.Fatalf("got message: %s, want: flaky", string(d.Body()))
+			}
+			if !reflect.DeepEqual(d.Headers(), headers) {
+				t.Errorf("got headers: %v, on retry: %d, want: %v", d.Headers(), i, headers)
+			}
+			if err := d.Nack(true); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		if err := q.Push([]byte("dropped"), 0, nil); err != nil {
+			t.Fatal(err.Error())
+		}
+		d, err = q.Pull()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(d.Body()) != "dropped" {
+			t.Fatalf("got message: %s, want: dropped", string(d.Body()))
+		}
+		if err := d.Nack(false); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		want := []queue.DeadLetter{
+			{Body: []byte("poison"), Priority: 1, Headers: headers, Reason: "malformed"},
+			{Body: []byte("flaky"), Priority: 1, Headers: headers, Reason: "too many retries", Retries: queue.MaxRetries},
+			{Body: []byte("dropped"), Reason: "rejected"},
+		}
+		letters, err := q.DeadLetters(0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(letters) != len(want) {
+			t.Fatalf("got %d dead letters, want: %d", len(letters), len(want))
+		}
+		for i, l := range letters {
+			if string(l.Body) != string(want[i].Body) || l.Priority != want[i].Priority ||
+				!reflect.DeepEqual(l.Headers, want[i].Headers) || l.Reason != want[i].Reason ||
+				l.Retries != want[i].Retries || l.DeadAt.IsZero() {
+				t.Errorf("got dead letter: %+v, want: %+v", l, want[i])
+			}
+		}
+
+		// looking doesn't take them out, requeueing does
+		n, err := q.Requeue(1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n != 1 {
+			t.Errorf("got %d requeued, want: 1", n)
+		}
+		d, err = q.Pull()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(d.Body()) != "poison" || !reflect.DeepEqual(d.Headers(), headers) {
+			t.Errorf("got message: %s, headers: %v, want: poison, %v", string(d.Body()), d.Headers(), headers)
+		}
+		if err := d.Ack(); err != nil {
+			t.Fatal(err.Error())
+		}
+		n, err = q.Purge()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n != 2 {
+			t.Errorf("got %d purged, want: 2", n)
+		}
+		letters, err = q.DeadLetters(0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(letters) != 0 {
+			t.Errorf("got %d dead letters after purge, want: 0", len(letters))
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		q, err := newQueue(0)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if err := q.Ping(); err != nil {
+			t.Fatal(err.Error())
+		}
+		errs := make(chan error, 1)
+		go func() {
+			_, err := q.Pull()
+			errs <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		if err := q.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := q.Ping(); err == nil {
+			t.Error("ping on a closed queue returned no error")
+		}
+
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Error("pull on a closed queue returned no error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("pull still blocks after close")
+		}
+	})
+}
+
+// pull takes the next message off q and acknowledges it.
+func pull(t *testing.T, q queue.Queue) string {
+	d, err := q.Pull()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatal(err.Error())
+	}
+	return string(d.Body())
+}
@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/domain/priority"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// session is one connection with the channels on it. When any of them closes
+// the whole session is done with and a new one dialed.
+type session struct {
+	conn   *amqp.Connection
+	prod   *amqp.Channel
+	cons   *amqp.Channel
+	msgs   <-chan amqp.Delivery
+	closes []chan *amqp.Error
+	dead   chan struct{} // closed once the session is found dead
+}
+
+func (s *session) close() error {
+	if err := s.conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (q *queue) dial() (*session, error) {
+	conn, err := amqp.DialConfig(q.url, q.config)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := q.open(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (q *queue) open(conn *amqp.Connection) (*session, error) {
+	prod, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	// confirms tell apart the messages x-overflow rejects
+	if err := prod.Confirm(false); err != nil {
+		return nil, err
+	}
+	if err := declareDead(prod, q.name); err != nil {
+		return nil, err
+	}
+
+	if err := declare(prod, q.name, q.maxSize); err != nil {
+		return nil, err
+	}
+
+	cons, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := cons.Qos(q.prefetch, 0, false); err != nil {
+		return nil, err
+	}
+	msgs, err := cons.Consume(
+		q.name, // queue name
+		"",     // consumer tag
+		false,  // auto-ack
+		false,  // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{
+		conn: conn,
+		prod: prod,
+		cons: cons,
+		msgs: msgs,
+		closes: []chan *amqp.Error{
+			conn.NotifyClose(make(chan *amqp.Error, 1)),
+			prod.NotifyClose(make(chan *amqp.Error, 1)),
+			cons.NotifyClose(make(chan *amqp.Error, 1)),
+		},
+		dead: make(chan struct{}),
+	}, nil
+}
+
+// declare declares the queue name with its priorities and dead letters, at
+// most maxSize messages long for a maxSize above 0. RabbitMQ refuses to
+// redeclare a queue declared otherwise before, that is ErrIncompatible.
+func declare(ch *amqp.Channel, name string, maxSize int) error {
+	args := amqp.Table{
+		"x-max-priority":         priority.Max,
+		"x-dead-letter-exchange": name + ".dlx",
+	}
+	if maxSize > 0 {
+		args["x-max-length"] = maxSize // Maximum messages
+		args["x-overflow"] = "reject-publish"
+	}
+	_, err := ch.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		args,
+	)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("%w: %s", ErrIncompatible, amqpErr.Reason)
+	}
+	return err
+}
+
+// wait blocks until the connection or one of the channels of s closes.
+func (s *session) wait() *amqp.Error {
+	cases := make(chan *amqp.Error, len(s.closes))
+	for _, c := range s.closes {
+		go func(c chan *amqp.Error) { cases <- <-c }(c)
+	}
+	return <-cases
+}
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// keepAlive replaces sess with a new session whenever it dies, until the
+// queue is closed.
+func (q *queue) keepAlive(sess *session) {
+	for {
+		reason := sess.wait()
+
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			close(sess.dead)
+			return
+		}
+		q.ready = make(chan struct{})
+		q.mu.Unlock()
+		close(sess.dead)
+		_ = sess.close()
+		slog.Warn("lost the connection, reconnecting", "adapter", "queue", "queue", q.name, "err", reason)
+
+		backoff := minBackoff
+		for {
+			select {
+			case <-q.done:
+				return
+			case <-time.After(backoff):
+			}
+			next, err := q.dial()
+			if err == nil {
+				sess = next
+				break
+			}
+			slog.Debug("reconnect failed", "adapter", "queue", "queue", q.name, "backoff", backoff, "err", err)
+			backoff = min(2*backoff, maxBackoff)
+		}
+
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			_ = sess.close()
+			return
+		}
+		q.session = sess
+		close(q.ready)
+		q.mu.Unlock()
+		slog.Info("reconnected", "adapter", "queue", "queue", q.name)
+	}
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Upgrade redeclares the queue name the way New does, for a queue an older
+// version declared otherwise. Its messages wait in the durable queue
+// name.upgrade meanwhile, so an upgrade that was cut off continues where it
+// stopped when run again. Nothing may push to or pull from the queue while
+// it runs. It returns how many messages were moved.
+func Upgrade(cfg *Config, name string, maxSize int) (int, error) {
+	url, config, err := cfg.dialConfig()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := amqp.DialConfig(url, config)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		return 0, err
+	}
+	if err := declareDead(ch, name); err != nil {
+		return 0, err
+	}
+	hold := name + ".upgrade"
+	_, err = ch.QueueDeclare(
+		hold,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// gone already if a previous run was cut off after deleting it
+	ok, err := exists(conn, name)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		if _, err := move(ch, name, hold); err != nil {
+			return 0, err
+		}
+		if _, err := ch.QueueDelete(name, false, false, false); err != nil {
+			return 0, err
+		}
+	}
+	if err := declare(ch, name, maxSize); err != nil {
+		return 0, err
+	}
+	n, err := move(ch, hold, name)
+	if err != nil {
+		return n, err
+	}
+	if _, err := ch.QueueDelete(hold, false, false, false); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// exists checks for the queue name on a channel of its own, asking for a
+// queue that isn't there closes the channel.
+func exists(conn *amqp.Connection, name string) (bool, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, err
+	}
+	defer ch.Close()
+	_, err = ch.QueueDeclarePassive(name, false, false, false, false, nil)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// move publishes the messages of from to to, each acknowledged only once
+// RabbitMQ confirmed its copy. ch has to be in confirm mode.
+func move(ch *amqp.Channel, from, to string) (int, error) {
+	n := 0
+	for {
+		msg, ok, err := ch.Get(from, false)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			return n, nil
+		}
+		conf, err := ch.PublishWithDeferredConfirmWithContext(
+			context.Background(),
+			"",    // exchange
+			to,    // routing key
+			false, // mandatory
+			false, // immediate
+			amqp.Publishing{
+				ContentType:  msg.ContentType,
+				DeliveryMode: amqp.Persistent,
+				Priority:     msg.Priority,
+				Headers:      msg.Headers,
+				Timestamp:    msg.Timestamp,
+				Body:         msg.Body,
+			})
+		if err != nil {
+			return n, err
+		}
+		if !conf.Wait() {
+			return n, fmt.Errorf("'%s' refused a message: %w", to, ErrFull)
+		}
+		if err := msg.Ack(false); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
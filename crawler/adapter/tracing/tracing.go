@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/kfc-manager/vision-seeker/crawler"
+
+// propagator carries span contexts through queue messages. It doesn't go
+// through the global one, which is a no-op until Setup.
+var propagator = propagation.TraceContext{}
+
+// Setup installs the tracer provider for exporter. "otlp" sends spans to the
+// collector at OTEL_EXPORTER_OTLP_ENDPOINT, "stdout" prints them and "none"
+// leaves tracing off. Sampling follows OTEL_TRACES_SAMPLER. The returned
+// function flushes the spans still buffered.
+func Setup(exporter string) (func() error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "none":
+		return func() error { return nil }, nil
+	case "otlp":
+		exp, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		exp, err = stdouttrace.New()
+	default:
+		return nil, fmt.Errorf("unknown trace exporter '%s'", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return provider.Shutdown(ctx)
+	}, nil
+}
+
+// Start starts a span named name as a child of the one in ctx.
+func Start(
+	ctx context.Context,
+	name string,
+	opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End ends span, marking it failed with err if there is one.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Do runs fn in a span named name.
+func Do[T any](ctx context.Context, name string, fn func() (T, error)) (T, error) {
+	_, span := Start(ctx, name)
+	v, err := fn()
+	End(span, err)
+	return v, err
+}
+
+// Run runs fn in a span named name.
+func Run(ctx context.Context, name string, fn func() error) error {
+	_, span := Start(ctx, name)
+	err := fn()
+	End(span, err)
+	return err
+}
+
+// Inject returns the span context of ctx to be sent along a message, nil if
+// there is none.
+func Inject(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns the span context Inject put into carrier, an invalid one
+// if there is none.
+func Extract(carrier map[string]string) trace.SpanContext {
+	if len(carrier) < 1 {
+		return trace.SpanContext{}
+	}
+	ctx := propagator.Extract(context.Background(), propagation.MapCarrier(carrier))
+	return trace.SpanContextFromContext(ctx)
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPropagate(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	if carrier := Inject(context.Background()); carrier != nil {
+		t.Errorf("got carrier without a span: %v", carrier)
+	}
+	if Extract(nil).IsValid() {
+		t.Error("got a span context out of nothing")
+	}
+
+	ctx, span := Start(context.Background(), "page")
+	defer span.End()
+	sc := Extract(Inject(ctx))
+	if sc.TraceID() != span.SpanContext().TraceID() || sc.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("got span context: %v, want: %v", sc, span.SpanContext())
+	}
+
+	fail := errors.New("fail")
+	if err := Run(ctx, "store", func() error { return fail }); err != fail {
+		t.Errorf("got error: %v, want: %v", err, fail)
+	}
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Name() != "store" || ended[0].Status().Code != codes.Error ||
+		ended[0].Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("unexpected spans: %v", ended)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	if _, err := Setup("jaeger"); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+	shutdown, err := Setup("none")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := shutdown(); err != nil {
+		t.Fatal(err.Error())
+	}
+}
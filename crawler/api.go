@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/service/api"
+	"github.com/kfc-manager/vision-seeker/crawler/service/health"
+)
+
+// apiCmd serves the collected images on API_ADDR until it fails.
+func apiCmd() {
+	db, err := newDatabase()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	catalog, ok := db.(database.Catalog)
+	if !ok {
+		panic(errors.New("the api needs the images in Postgres, not in a standalone store"))
+	}
+	buck, err := newBucket()
+	if err != nil {
+		panic(err)
+	}
+
+	checks := health.New()
+	checks.Ready("database", db.Ping)
+	startServer(checks)
+
+	addr := envOrDefault("API_ADDR", ":8080")
+	slog.Info("serving the api", "addr", addr)
+	handler := api.New(catalog, bucket.NewSharded(buck), slog.Default()).Handler()
+	panic(http.ListenAndServe(addr, handler))
+}
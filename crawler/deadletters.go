@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+type deadLetter struct {
+	Message  any       `json:"message"`
+	Reason   string    `json:"reason"`
+	Retries  int       `json:"retries"`
+	Priority uint8     `json:"priority"`
+	DeadAt   time.Time `json:"dead_at"`
+}
+
+// deadLetters inspects, requeues or purges the messages the crawler gave up
+// on.
+func deadLetters(args []string) {
+	if len(args) < 1 {
+		panic(errors.New("expected dead-letters list, requeue or purge"))
+	}
+	flags := flag.NewFlagSet("dead-letters "+args[0], flag.ExitOnError)
+	limit := flags.Int("n", 0, "dead letters to list or requeue, 0 is all")
+	flags.Parse(args[1:])
+
+	db, _, que, err := newStores()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	defer que.Close()
+
+	switch cmd := args[0]; cmd {
+	case "list":
+		letters, err := que.DeadLetters(*limit)
+		if err != nil {
+			panic(err)
+		}
+		out := make([]*deadLetter, len(letters))
+		for i, l := range letters {
+			out[i] = &deadLetter{
+				Message:  string(l.Body),
+				Reason:   l.Reason,
+				Retries:  l.Retries,
+				Priority: l.Priority,
+				DeadAt:   l.DeadAt,
+			}
+			if json.Valid(l.Body) {
+				out[i].Message = json.RawMessage(l.Body)
+			}
+		}
+		printReport(out)
+	case "requeue":
+		n, err := que.Requeue(*limit)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("requeued %d dead letters\n", n)
+	case "purge":
+		n, err := que.Purge()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("purged %d dead letters\n", n)
+	default:
+		panic(fmt.Errorf("unknown dead-letters command '%s', expected list, requeue or purge", cmd))
+	}
+}
@@ -0,0 +1,206 @@
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync"
+)
+
+// ratio tightens the false positive rate of every slice added when the
+// previous one is full, so the rate of the whole filter stays below the
+// configured one however far it grows.
+const ratio = 0.5
+
+var magic = [4]byte{'B', 'L', 'M', '1'}
+
+// Filter is a scalable Bloom filter. Test never misses a key that was added,
+// but may report ones that weren't. It grows by adding slices of twice the
+// capacity of the last one.
+type Filter struct {
+	mu     sync.RWMutex
+	fp     float64
+	slices []*slice
+}
+
+type slice struct {
+	capacity uint64
+	count    uint64
+	m        uint64 // bits
+	k        uint64 // hash functions
+	bits     []uint64
+}
+
+func newSlice(capacity uint64, fp float64) *slice {
+	n := float64(capacity)
+	m := uint64(math.Ceil(-n * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &slice{
+		capacity: capacity,
+		m:        m,
+		k:        k,
+		bits:     make([]uint64, (m+63)/64),
+	}
+}
+
+// New returns a filter sized for capacity keys before it first grows, with
+// a false positive rate of at most fp.
+func New(capacity uint64, fp float64) *Filter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	f := &Filter{fp: fp * (1 - ratio)}
+	f.slices = []*slice{newSlice(capacity, f.fp)}
+	return f
+}
+
+// hashes derives every bit position from two halves of a 128 bit hash
+// (Kirsch and Mitzenmacher).
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+func (s *slice) add(h1, h2 uint64) {
+	for i := uint64(0); i < s.k; i++ {
+		bit := (h1 + i*h2) % s.m
+		s.bits[bit/64] |= 1 << (bit % 64)
+	}
+	s.count++
+}
+
+func (s *slice) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < s.k; i++ {
+		bit := (h1 + i*h2) % s.m
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) test(h1, h2 uint64) bool {
+	for _, s := range f.slices {
+		if s.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) Add(key string) {
+	h1, h2 := hashes(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.test(h1, h2) {
+		return
+	}
+
+	last := f.slices[len(f.slices)-1]
+	if last.count >= last.capacity {
+		fp := f.fp * math.Pow(ratio, float64(len(f.slices)))
+		last = newSlice(last.capacity*2, fp)
+		f.slices = append(f.slices, last)
+	}
+	last.add(h1, h2)
+}
+
+// Test reports whether key may have been added. False means it definitely
+// wasn't.
+func (f *Filter) Test(key string) bool {
+	h1, h2 := hashes(key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.test(h1, h2)
+}
+
+// Count returns how many distinct keys were added. Keys that collided with a
+// false positive aren't counted.
+func (f *Filter) Count() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	count := uint64(0)
+	for _, s := range f.slices {
+		count += s.count
+	}
+	return count
+}
+
+// WriteTo writes a snapshot of f that Load reads back.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	buf := bufio.NewWriter(w)
+	cw := &countWriter{w: buf}
+	header := []any{magic, math.Float64bits(f.fp), uint64(len(f.slices))}
+	for _, v := range header {
+		if err := binary.Write(cw, binary.BigEndian, v); err != nil {
+			return cw.n, err
+		}
+	}
+	for _, s := range f.slices {
+		for _, v := range []any{s.capacity, s.count, s.m, s.k, s.bits} {
+			if err := binary.Write(cw, binary.BigEndian, v); err != nil {
+				return cw.n, err
+			}
+		}
+	}
+	return cw.n, buf.Flush()
+}
+
+func Load(r io.Reader) (*Filter, error) {
+	r = bufio.NewReader(r)
+	header := struct {
+		Magic  [4]byte
+		Fp     uint64
+		Slices uint64
+	}{}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != magic {
+		return nil, errors.New("not a bloom filter snapshot")
+	}
+
+	f := &Filter{fp: math.Float64frombits(header.Fp)}
+	for i := uint64(0); i < header.Slices; i++ {
+		s := &slice{}
+		for _, v := range []*uint64{&s.capacity, &s.count, &s.m, &s.k} {
+			if err := binary.Read(r, binary.BigEndian, v); err != nil {
+				return nil, err
+			}
+		}
+		if s.m < 1 || s.k < 1 || s.m > 1<<40 {
+			return nil, errors.New("corrupt bloom filter snapshot")
+		}
+		s.bits = make([]uint64, (s.m+63)/64)
+		if err := binary.Read(r, binary.BigEndian, s.bits); err != nil {
+			return nil, err
+		}
+		f.slices = append(f.slices, s)
+	}
+	if len(f.slices) < 1 {
+		return nil, errors.New("corrupt bloom filter snapshot")
+	}
+	return f, nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,68 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	// starts far too small, so it has to grow a few times
+	f := New(1000, 0.01)
+	for i := 0; i < 20000; i++ {
+		f.Add(fmt.Sprintf("added-%d", i))
+	}
+	if len(f.slices) < 2 {
+		t.Errorf("filter didn't grow, got %d slices", len(f.slices))
+	}
+
+	for i := 0; i < 20000; i++ {
+		if !f.Test(fmt.Sprintf("added-%d", i)) {
+			t.Fatalf("added key missing: added-%d", i)
+		}
+	}
+
+	fp := 0
+	for i := 0; i < 20000; i++ {
+		if f.Test(fmt.Sprintf("other-%d", i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 20000; rate > 0.01 {
+		t.Errorf("got false positive rate: %f, want at most: 0.01", rate)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	f := New(100, 0.01)
+	for i := 0; i < 500; i++ {
+		f.Add(fmt.Sprintf("added-%d", i))
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := f.WriteTo(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	loaded, err := Load(buf)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if loaded.Count() != f.Count() {
+		t.Errorf("got count: %d, want: %d", loaded.Count(), f.Count())
+	}
+	for i := 0; i < 500; i++ {
+		if !loaded.Test(fmt.Sprintf("added-%d", i)) {
+			t.Fatalf("added key missing after load: added-%d", i)
+		}
+	}
+
+	// keeps growing like the original
+	loaded.Add("one more")
+	if !loaded.Test("one more") {
+		t.Error("key added after load missing")
+	}
+
+	if _, err := Load(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Error("loaded garbage")
+	}
+}
@@ -2,6 +2,8 @@ package html
 
 import (
 	"bytes"
+	"strconv"
+	"strings"
 
 	gohtml "golang.org/x/net/html"
 )
@@ -43,15 +45,21 @@ func (node *Node) Attribute(key string) string {
 	return attr
 }
 
-func (node *Node) Links() []string {
-	links := []string{}
+// Link is an href and the text it is anchored to.
+type Link struct {
+	Href string
+	Text string
+}
+
+func (node *Node) Links() []*Link {
+	links := []*Link{}
 	if node.Type == gohtml.ElementNode && node.Data == "img" {
 		return links
 	}
 
 	l := node.Attribute("href")
 	if len(l) > 0 {
-		links = append(links, l)
+		links = append(links, &Link{Href: l, Text: node.anchor()})
 	}
 	for c := node.FirstChild; c != nil; c = c.NextSibling {
 		child := &Node{c}
@@ -60,3 +68,50 @@ func (node *Node) Links() []string {
 
 	return links
 }
+
+// anchor is the text inside node, with the alt of images and the title of
+// node for links without text.
+func (node *Node) anchor() string {
+	parts := []string{}
+	var walk func(n *gohtml.Node)
+	walk = func(n *gohtml.Node) {
+		switch {
+		case n.Type == gohtml.TextNode:
+			parts = append(parts, strings.Fields(n.Data)...)
+		case n.Type == gohtml.ElementNode && n.Data == "img":
+			parts = append(parts, strings.Fields((&Node{n}).Attribute("alt"))...)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(node.Node)
+	if len(parts) < 1 {
+		return strings.TrimSpace(node.Attribute("title"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Source is a candidate of a srcset with the width it declares, 0 if it
+// declares a pixel density instead.
+type Source struct {
+	Url   string
+	Width int
+}
+
+// Srcset returns the candidates of the srcset attribute of node.
+func (node *Node) Srcset() []*Source {
+	sources := []*Source{}
+	for _, candidate := range strings.Split(node.Attribute("srcset"), ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) < 1 {
+			continue
+		}
+		src := &Source{Url: fields[0]}
+		if len(fields) > 1 && strings.HasSuffix(fields[1], "w") {
+			src.Width, _ = strconv.Atoi(strings.TrimSuffix(fields[1], "w"))
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
@@ -0,0 +1,53 @@
+package html
+
+import "testing"
+
+func TestLinks(t *testing.T) {
+	doc, err := Parse([]byte(`<html><body>
+		<a href="/gallery">Photo <b>gallery</b></a>
+		<a href="/cats"><img src="cat.png" alt="Cats"></a>
+		<a href="/about" title="About us"></a>
+	</body></html>`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	want := []Link{
+		{Href: "/gallery", Text: "Photo gallery"},
+		{Href: "/cats", Text: "Cats"},
+		{Href: "/about", Text: "About us"},
+	}
+	links := doc.Links()
+	if len(links) != len(want) {
+		t.Fatalf("got %d links, want: %d", len(links), len(want))
+	}
+	for i, l := range links {
+		if *l != want[i] {
+			t.Errorf("got link: %+v, want: %+v", *l, want[i])
+		}
+	}
+}
+
+func TestSrcset(t *testing.T) {
+	doc, err := Parse([]byte(`<img src="a.png"
+		srcset="a-480.png 480w, a-1080.png 1080w,a-2x.png 2x , a.png">`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	want := []Source{
+		{Url: "a-480.png", Width: 480},
+		{Url: "a-1080.png", Width: 1080},
+		{Url: "a-2x.png"},
+		{Url: "a.png"},
+	}
+	sources := doc.Images()[0].Srcset()
+	if len(sources) != len(want) {
+		t.Fatalf("got %d sources, want: %d", len(sources), len(want))
+	}
+	for i, src := range sources {
+		if *src != want[i] {
+			t.Errorf("got source: %+v, want: %+v", *src, want[i])
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+type ColorSpace string
+
+const (
+	SRGB      ColorSpace = "srgb"
+	DisplayP3 ColorSpace = "display-p3"
+	AdobeRGB  ColorSpace = "adobe-rgb"
+	RGB       ColorSpace = "rgb" // embedded RGB profile we don't recognize
+	Gray      ColorSpace = "gray"
+	CMYK      ColorSpace = "cmyk"
+	YCCK      ColorSpace = "ycck"
+)
+
+// profile holds the parts of an ICC profile needed for a matrix/TRC
+// conversion into sRGB. LUT based profiles (usually CMYK) only get their
+// color space and description parsed.
+type profile struct {
+	space  string
+	desc   string
+	matrix *[3][3]float64
+	trc    [3]curve
+}
+
+// xyzToSRGB converts D50 adapted XYZ (the ICC profile connection space)
+// into linear sRGB, Bradford adaptation included.
+var xyzToSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// sRGB primaries as they appear in the rXYZ/gXYZ/bXYZ tags of an sRGB
+// profile, used to spot sRGB profiles with an unusual description.
+var srgbColorants = [3][3]float64{
+	{0.4361, 0.3851, 0.1431},
+	{0.2225, 0.7169, 0.0606},
+	{0.0139, 0.0971, 0.7141},
+}
+
+func parseProfile(b []byte) (*profile, error) {
+	if len(b) < 132 || string(b[36:40]) != "acsp" {
+		return nil, errors.New("invalid icc profile")
+	}
+
+	p := &profile{space: strings.TrimSpace(string(b[16:20]))}
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(b[128:132]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(b) {
+			break
+		}
+		off := int(binary.BigEndian.Uint32(b[entry+4 : entry+8]))
+		size := int(binary.BigEndian.Uint32(b[entry+8 : entry+12]))
+		if off < 0 || size < 0 || off+size > len(b) {
+			continue
+		}
+		tags[string(b[entry:entry+4])] = b[off : off+size]
+	}
+
+	if desc, ok := tags["desc"]; ok {
+		p.desc = parseText(desc)
+	}
+
+	if p.space != "RGB" {
+		return p, nil
+	}
+
+	var m [3][3]float64
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		tag, ok := tags[sig]
+		if !ok || len(tag) < 20 || string(tag[:4]) != "XYZ " {
+			return p, nil
+		}
+		for j := 0; j < 3; j++ {
+			m[j][i] = s15Fixed16(tag[8+j*4:])
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tag, ok := tags[sig]
+		if !ok {
+			return p, nil
+		}
+		c, err := parseCurve(tag)
+		if err != nil || !finite(c) {
+			return p, nil
+		}
+		p.trc[i] = c
+	}
+	p.matrix = &m
+
+	return p, nil
+}
+
+func (p *profile) colorSpace() ColorSpace {
+	desc := strings.ToLower(p.desc)
+	switch p.space {
+	case "GRAY":
+		return Gray
+	case "CMYK":
+		return CMYK
+	case "RGB":
+		switch {
+		case strings.Contains(desc, "p3"):
+			return DisplayP3
+		case strings.Contains(desc, "adobe rgb"):
+			return AdobeRGB
+		case strings.Contains(desc, "srgb"):
+			return SRGB
+		case p.matrix != nil && closeTo(*p.matrix, srgbColorants, 0.002):
+			return SRGB
+		}
+		return RGB
+	}
+	return ColorSpace(strings.ToLower(p.space))
+}
+
+func parseText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:12]))
+		if 12+n > len(tag) {
+			n = len(tag) - 12
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case "mluc":
+		if len(tag) < 28 {
+			return ""
+		}
+		// first record is good enough, descriptions rarely differ by locale
+		n := int(binary.BigEndian.Uint32(tag[20:24]))
+		off := int(binary.BigEndian.Uint32(tag[24:28]))
+		if off+n > len(tag) {
+			return ""
+		}
+		u := make([]uint16, n/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(tag[off+i*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	}
+	return ""
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// curve maps an encoded channel value in [0,1] to linear light.
+type curve func(v float64) float64
+
+func parseCurve(tag []byte) (curve, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("invalid curve")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:12]))
+		if 12+n*2 > len(tag) {
+			return nil, errors.New("invalid curve")
+		}
+		if n == 0 {
+			return func(v float64) float64 { return v }, nil
+		}
+		if n == 1 {
+			gamma := float64(binary.BigEndian.Uint16(tag[12:14])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }, nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return func(v float64) float64 {
+			pos := v * float64(n-1)
+			i := int(pos)
+			if i >= n-1 {
+				return table[n-1]
+			}
+			frac := pos - float64(i)
+			return table[i] + (table[i+1]-table[i])*frac
+		}, nil
+	case "para":
+		kind := binary.BigEndian.Uint16(tag[8:10])
+		counts := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}
+		n, ok := counts[kind]
+		if !ok || 12+n*4 > len(tag) {
+			return nil, errors.New("invalid parametric curve")
+		}
+		var prm [7]float64
+		for i := 0; i < n; i++ {
+			prm[i] = s15Fixed16(tag[12+i*4:])
+		}
+		g, a, b, c, d, e, f := prm[0], prm[1], prm[2], prm[3], prm[4], prm[5], prm[6]
+		return func(v float64) float64 {
+			switch kind {
+			case 0:
+				return math.Pow(v, g)
+			case 1:
+				if v >= -b/a {
+					return math.Pow(a*v+b, g)
+				}
+				return 0
+			case 2:
+				if v >= -b/a {
+					return math.Pow(a*v+b, g) + c
+				}
+				return c
+			case 3:
+				if v >= d {
+					return math.Pow(a*v+b, g)
+				}
+				return c * v
+			}
+			if v >= d {
+				return math.Pow(a*v+b, g) + e
+			}
+			return c*v + f
+		}, nil
+	}
+	return nil, errors.New("unsupported curve type")
+}
+
+// finite reports whether c maps every channel value convert looks up to a
+// number, crafted parameters make math.Pow return NaN or infinity.
+func finite(c curve) bool {
+	for v := 0; v < 256; v++ {
+		l := c(float64(v) / 255)
+		if math.IsNaN(l) || math.IsInf(l, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// convert maps every pixel through the profile's TRC and colorants into
+// linear sRGB and encodes the result with the sRGB transfer function.
+func (p *profile) convert(src image.Image) *image.NRGBA {
+	m := mul(xyzToSRGB, *p.matrix)
+	var lin [3][256]float64
+	for c := 0; c < 3; c++ {
+		for v := 0; v < 256; v++ {
+			lin[c][v] = p.trc[c](float64(v) / 255)
+		}
+	}
+	enc := srgbTable()
+
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			r, g, b := lin[0][c.R], lin[1][c.G], lin[2][c.B]
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: enc.lookup(m[0][0]*r + m[0][1]*g + m[0][2]*b),
+				G: enc.lookup(m[1][0]*r + m[1][1]*g + m[1][2]*b),
+				B: enc.lookup(m[2][0]*r + m[2][1]*g + m[2][2]*b),
+				A: c.A,
+			})
+		}
+	}
+	return dst
+}
+
+type encodeTable []uint8
+
+// srgbTable precomputes the sRGB transfer function, math.Pow per channel
+// and pixel is too slow for photos.
+func srgbTable() encodeTable {
+	t := make(encodeTable, 4096)
+	for i := range t {
+		v := float64(i) / float64(len(t)-1)
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		t[i] = uint8(math.Round(v * 255))
+	}
+	return t
+}
+
+func (t encodeTable) lookup(v float64) uint8 {
+	// NaN fails every comparison, it would index far out of range
+	if !(v > 0) {
+		return t[0]
+	}
+	if v >= 1 {
+		return t[len(t)-1]
+	}
+	return t[int(v*float64(len(t)-1)+0.5)]
+}
+
+func closeTo(a, b [3][3]float64, eps float64) bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(a[i][j]-b[i][j]) > eps {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func mul(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+// jpegInfo is what we need to know about a jpeg before and after decoding,
+// gathered by walking its marker segments up to the start of scan.
+type jpegInfo struct {
+	icc        []byte
+	components int
+	adobe      bool
+	transform  byte
+}
+
+func scanJpeg(b []byte) *jpegInfo {
+	info := &jpegInfo{}
+	chunks := map[byte][]byte{}
+	total := 0
+
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xff {
+			break
+		}
+		marker := b[i+1]
+		if marker == 0xff {
+			i++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(b[i+2 : i+4]))
+		if n < 2 || i+2+n > len(b) {
+			break
+		}
+		seg := b[i+4 : i+2+n]
+
+		switch {
+		case marker == 0xe2 && len(seg) > 14 && string(seg[:12]) == "ICC_PROFILE\x00":
+			chunks[seg[12]] = seg[14:]
+			total = int(seg[13])
+		case marker == 0xee && len(seg) >= 12 && string(seg[:5]) == "Adobe":
+			info.adobe = true
+			info.transform = seg[11]
+		case marker >= 0xc0 && marker <= 0xcf &&
+			marker != 0xc4 && marker != 0xc8 && marker != 0xcc && len(seg) >= 6:
+			info.components = int(seg[5])
+		}
+		i += 2 + n
+	}
+
+	// profiles bigger than one segment are split and numbered from 1
+	for seq := 1; seq <= total; seq++ {
+		chunk, ok := chunks[byte(seq)]
+		if !ok {
+			info.icc = nil
+			break
+		}
+		info.icc = append(info.icc, chunk...)
+	}
+
+	return info
+}
+
+// withAdobe inserts an Adobe APP14 segment right after SOI, so 4 component
+// jpegs written without one can still be decoded as CMYK.
+func withAdobe(b []byte) []byte {
+	seg := []byte{
+		0xff, 0xee, 0x00, 0x0e,
+		'A', 'd', 'o', 'b', 'e',
+		0x00, 0x64, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	out := make([]byte, 0, len(b)+len(seg))
+	out = append(out, b[:2]...)
+	out = append(out, seg...)
+	return append(out, b[2:]...)
+}
+
+func pngICC(b []byte) []byte {
+	for i := 8; i+12 <= len(b); {
+		n := int(binary.BigEndian.Uint32(b[i : i+4]))
+		typ := string(b[i+4 : i+8])
+		if n < 0 || i+12+n > len(b) {
+			return nil
+		}
+		data := b[i+8 : i+8+n]
+		if typ == "iCCP" {
+			// profile name, null separator, compression method, zlib stream
+			sep := bytes.IndexByte(data, 0)
+			if sep < 0 || sep+2 > len(data) {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(data[sep+2:]))
+			if err != nil {
+				return nil
+			}
+			defer r.Close()
+			icc, err := io.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			return icc
+		}
+		if typ == "IDAT" || typ == "IEND" {
+			return nil
+		}
+		i += 12 + n
+	}
+	return nil
+}
+
+func webpICC(b []byte) []byte {
+	if len(b) < 12 || string(b[:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return nil
+	}
+	for i := 12; i+8 <= len(b); {
+		n := int(binary.LittleEndian.Uint32(b[i+4 : i+8]))
+		if n < 0 || i+8+n > len(b) {
+			return nil
+		}
+		if string(b[i:i+4]) == "ICCP" {
+			return b[i+8 : i+8+n]
+		}
+		i += 8 + n + n%2
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+var displayP3Colorants = [3][3]float64{
+	{0.5151, 0.2920, 0.1571},
+	{0.2412, 0.6922, 0.0666},
+	{-0.0011, 0.0419, 0.7841},
+}
+
+func fixed(v float64) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(int32(v*65536)))
+	return b
+}
+
+// paraCurve writes a parametric curve of the given type.
+func paraCurve(kind byte, params ...float64) []byte {
+	trc := []byte{'p', 'a', 'r', 'a', 0, 0, 0, 0, 0, kind, 0, 0}
+	for _, v := range params {
+		trc = append(trc, fixed(v)...)
+	}
+	return trc
+}
+
+// buildProfile writes a minimal v2 matrix/TRC display profile using the
+// sRGB transfer function for all channels.
+func buildProfile(desc string, colorants [3][3]float64) []byte {
+	return buildProfileTRC(desc, colorants, paraCurve(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045))
+}
+
+// buildProfileTRC writes the profile with trc for all channels.
+func buildProfileTRC(desc string, colorants [3][3]float64, trc []byte) []byte {
+	descTag := []byte("desc\x00\x00\x00\x00")
+	descTag = binary.BigEndian.AppendUint32(descTag, uint32(len(desc)+1))
+	descTag = append(descTag, desc...)
+	descTag = append(descTag, 0)
+
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	tags := []tag{{"desc", descTag}}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		data := []byte("XYZ \x00\x00\x00\x00")
+		for j := 0; j < 3; j++ {
+			data = append(data, fixed(colorants[j][i])...)
+		}
+		tags = append(tags, tag{sig, data})
+	}
+	for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tags = append(tags, tag{sig, trc})
+	}
+
+	header := make([]byte, 128)
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	off := 128 + 4 + len(tags)*12
+	body := []byte{}
+	for _, t := range tags {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		table = append(table, t.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(off+len(body)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+		body = append(body, t.data...)
+	}
+
+	b := append(header, table...)
+	b = append(b, body...)
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 32), uint8(y * 32), 150, 255})
+		}
+	}
+	return img
+}
+
+func pngWithProfile(t *testing.T, icc []byte) []byte {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, testImage()); err != nil {
+		t.Fatal(err.Error())
+	}
+	b := buf.Bytes()
+
+	z := &bytes.Buffer{}
+	w := zlib.NewWriter(z)
+	w.Write(icc)
+	w.Close()
+	data := append([]byte("icc\x00\x00"), z.Bytes()...)
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, "iCCP"...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// iCCP has to come before IDAT, right after the 25 byte IHDR chunk
+	out := append([]byte{}, b[:33]...)
+	out = append(out, chunk...)
+	return append(out, b[33:]...)
+}
+
+func jpegWithProfile(t *testing.T, icc []byte, chunks int) []byte {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, testImage(), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	b := buf.Bytes()
+
+	out := append([]byte{}, b[:2]...)
+	for i := 0; i < chunks; i++ {
+		size := (len(icc) + chunks - 1) / chunks
+		part := icc[i*size : min((i+1)*size, len(icc))]
+		seg := append([]byte("ICC_PROFILE\x00"), byte(i+1), byte(chunks))
+		seg = append(seg, part...)
+		out = append(out, 0xff, 0xe2)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+		out = append(out, seg...)
+	}
+	return append(out, b[2:]...)
+}
+
+func TestColorSpace(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input []byte
+		want  ColorSpace
+	}{
+		{
+			"jpeg without profile",
+			jpegWithProfile(t, nil, 0),
+			SRGB,
+		},
+		{
+			"png display p3",
+			pngWithProfile(t, buildProfile("Display P3", displayP3Colorants)),
+			DisplayP3,
+		},
+		{
+			"png srgb by colorants",
+			pngWithProfile(t, buildProfile("Monitor", srgbColorants)),
+			SRGB,
+		},
+		{
+			"jpeg adobe rgb split profile",
+			jpegWithProfile(t, buildProfile("Adobe RGB (1998)", displayP3Colorants), 3),
+			AdobeRGB,
+		},
+		{
+			"jpeg unknown rgb",
+			jpegWithProfile(t, buildProfile("Camera", displayP3Colorants), 1),
+			RGB,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := Load(test.input)
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if img.ColorSpace != test.want {
+				t.Errorf("got: %s, want: %s", img.ColorSpace, test.want)
+			}
+		})
+	}
+}
+
+func TestToSRGB(t *testing.T) {
+	diff := func(a, b uint8) int {
+		if a > b {
+			return int(a - b)
+		}
+		return int(b - a)
+	}
+
+	img, err := Load(pngWithProfile(t, buildProfile("sRGB IEC61966-2.1", srgbColorants)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := img.ToSRGB(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if img.profile == nil {
+		t.Error("sRGB image should not have been converted")
+	}
+
+	p3, err := Load(pngWithProfile(t, buildProfile("Display P3", displayP3Colorants)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// check the conversion itself against an identity conversion first
+	ident, err := parseProfile(buildProfile("sRGB", srgbColorants))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	same := ident.convert(testImage())
+	src := testImage()
+	for i := range src.Pix {
+		if diff(src.Pix[i], same.Pix[i]) > 2 {
+			t.Fatalf("identity conversion changed pixel %d: %d -> %d", i, src.Pix[i], same.Pix[i])
+		}
+	}
+
+	if err := p3.ToSRGB(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if p3.Format != "png" {
+		t.Errorf("got format: %s, want: png", p3.Format)
+	}
+	if p3.ColorSpace != DisplayP3 {
+		t.Errorf("got color space: %s, want: %s", p3.ColorSpace, DisplayP3)
+	}
+	reloaded, err := Load(p3.Data)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// P3 green is more saturated than anything sRGB can show, so red has to
+	// drop to zero while green stays at the top
+	c := color.NRGBAModel.Convert(reloaded.img.At(0, 7)).(color.NRGBA)
+	if c.R != 0 || c.G < 200 {
+		t.Errorf("unexpected converted color: %v", c)
+	}
+}
+
+func TestMalformedCurve(t *testing.T) {
+	// a negative a makes math.Pow take a negative base, which is NaN
+	trc := paraCurve(3, 2.4, -1, 0, 1/12.92, 0)
+	img, err := Load(pngWithProfile(t, buildProfileTRC("Camera", displayP3Colorants, trc)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := img.ToSRGB(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if img.Format != "png" || img.ColorSpace != RGB {
+		t.Errorf("got format: %s, color space: %s, want: png, %s", img.Format, img.ColorSpace, RGB)
+	}
+
+	enc := srgbTable()
+	if v := enc.lookup(math.NaN()); v != 0 {
+		t.Errorf("got: %d for NaN, want: 0", v)
+	}
+}
+
+// solidJpeg writes an 8x8 baseline jpeg with four components filled with the
+// given samples, as stored, with an Adobe APP14 segment carrying transform
+// unless adobe is false. image/jpeg can't write 4 component jpegs, every
+// block only has its DC coefficient, so a tiny encoder does.
+func solidJpeg(samples [4]uint8, adobe bool, transform byte) []byte {
+	segment := func(out []byte, marker byte, data ...byte) []byte {
+		out = append(out, 0xff, marker)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(data)+2))
+		return append(out, data...)
+	}
+
+	out := []byte{0xff, 0xd8}
+	if adobe {
+		out = segment(out, 0xee, 'A', 'd', 'o', 'b', 'e', 0x00, 0x64, 0, 0, 0, 0, transform)
+	}
+	// all ones, coefficients go through unchanged
+	out = segment(out, 0xdb, append([]byte{0x00}, bytes.Repeat([]byte{1}, 64)...)...)
+	out = segment(out, 0xc0, 8, 0, 8, 0, 8, 4,
+		1, 0x11, 0, 2, 0x11, 0, 3, 0x11, 0, 4, 0x11, 0)
+	// DC categories 0-11 with 4 bit codes, AC only has end of block as 0
+	dc := append([]byte{0x00, 0, 0, 0, 12}, make([]byte, 12)...)
+	out = segment(out, 0xc4, append(dc, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)...)
+	out = segment(out, 0xc4, append(append([]byte{0x10, 1}, make([]byte, 15)...), 0x00)...)
+	out = segment(out, 0xda, 4, 1, 0x00, 2, 0x00, 3, 0x00, 4, 0x00, 0, 63, 0)
+
+	bits := []byte{}
+	write := func(v, size int) {
+		for i := size - 1; i >= 0; i-- {
+			bits = append(bits, byte(v>>i&1))
+		}
+	}
+	for _, s := range samples {
+		// a flat block decodes to DC/8 + 128
+		dcv := 8 * (int(s) - 128)
+		cat, mag := 0, dcv
+		if mag < 0 {
+			mag = -mag
+		}
+		for ; mag > 0; mag >>= 1 {
+			cat++
+		}
+		write(cat, 4)
+		if dcv < 0 {
+			dcv += 1<<cat - 1
+		}
+		write(dcv, cat)
+		write(0, 1)
+	}
+	// pad with ones to full bytes
+	for len(bits)%8 != 0 {
+		bits = append(bits, 1)
+	}
+	for i := 0; i < len(bits); i += 8 {
+		b := byte(0)
+		for _, bit := range bits[i : i+8] {
+			b = b<<1 | bit
+		}
+		out = append(out, b)
+		if b == 0xff {
+			out = append(out, 0x00)
+		}
+	}
+	return append(out, 0xff, 0xd9)
+}
+
+func TestCMYK(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	var tests = []struct {
+		name    string
+		samples [4]uint8
+		adobe   bool
+		trans   byte
+		space   ColorSpace
+	}{
+		// without APP14 the samples are plain CMYK
+		{"cmyk without adobe", [4]uint8{0, 255, 255, 0}, false, 0, CMYK},
+		// Adobe stores them inverted
+		{"adobe cmyk", [4]uint8{255, 0, 0, 255}, true, 0, CMYK},
+		// the inverse of red as YCbCr and an inverted K of none
+		{"adobe ycck", [4]uint8{179, 171, 1, 255}, true, 2, YCCK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := Load(solidJpeg(test.samples, test.adobe, test.trans))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if img.ColorSpace != test.space {
+				t.Errorf("got color space: %s, want: %s", img.ColorSpace, test.space)
+			}
+			if err := img.ToSRGB(); err != nil {
+				t.Fatal(err.Error())
+			}
+			if img.Format != "jpeg" {
+				t.Errorf("got format: %s, want: jpeg", img.Format)
+			}
+			reloaded, err := Load(img.Data)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if reloaded.ColorSpace != SRGB {
+				t.Errorf("got color space after conversion: %s, want: %s", reloaded.ColorSpace, SRGB)
+			}
+			c := color.NRGBAModel.Convert(reloaded.img.At(4, 4)).(color.NRGBA)
+			for i, v := range []uint8{c.R, c.G, c.B} {
+				want := []uint8{red.R, red.G, red.B}[i]
+				if int(v)-int(want) > 12 || int(want)-int(v) > 12 {
+					t.Errorf("got color: %v, want about: %v", c, red)
+					break
+				}
+			}
+		})
+	}
+}
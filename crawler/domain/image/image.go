@@ -5,8 +5,8 @@ import (
 	"image"
 	"image/color"
 	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
+	"image/jpeg"
+	"image/png"
 	"math"
 
 	_ "golang.org/x/image/bmp"
@@ -15,31 +15,154 @@ import (
 )
 
 type Image struct {
-	Size    int
-	Width   int
-	Height  int
-	entropy *float64
-	Format  string
-	Data    []byte
-	img     image.Image
+	Size       int
+	Width      int
+	Height     int
+	entropy    *float64
+	Format     string
+	ColorSpace ColorSpace // as published, ToSRGB doesn't change it
+	Data       []byte
+	img        image.Image
+	profile    *profile
+	thumb      *image.NRGBA // downsampled for the placeholders
+	blurHash   *string
+	thumbHash  *string
 }
 
 func Load(b []byte) (*Image, error) {
 	img, form, err := image.Decode(bytes.NewReader(b))
 	if err != nil {
-		return nil, err
+		img, err = decodeCMYK(b, err)
+		if err != nil {
+			return nil, err
+		}
+		form = "jpeg"
+	}
+
+	var icc []byte
+	var info *jpegInfo
+	switch form {
+	case "jpeg":
+		info = scanJpeg(b)
+		icc = info.icc
+	case "png":
+		icc = pngICC(b)
+	case "webp":
+		icc = webpICC(b)
+	}
+
+	space := SRGB
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		space = Gray
+	}
+	prof, err := parseProfile(icc)
+	if err == nil {
+		space = prof.colorSpace()
+	} else {
+		prof = nil
+	}
+	if info != nil && info.components == 4 {
+		space = CMYK
+		// same rule as image/jpeg, any Adobe transform but 0 means YCCK
+		if info.adobe && info.transform != 0 {
+			space = YCCK
+		}
 	}
 
 	return &Image{
-		Size:   len(b),
-		Width:  img.Bounds().Dx(),
-		Height: img.Bounds().Dy(),
-		Format: form,
-		Data:   b,
-		img:    img,
+		Size:       len(b),
+		Width:      img.Bounds().Dx(),
+		Height:     img.Bounds().Dy(),
+		Format:     form,
+		ColorSpace: space,
+		Data:       b,
+		img:        img,
+		profile:    prof,
 	}, nil
 }
 
+// Format detects the format from the header only, without decoding pixels.
+func Format(b []byte) (string, error) {
+	_, form, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	return form, nil
+}
+
+// decodeCMYK retries 4 component jpegs without an Adobe APP14 segment, which
+// image/jpeg refuses to decode. Such files store plain (not inverted) CMYK.
+func decodeCMYK(b []byte, err error) (image.Image, error) {
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil, err
+	}
+	info := scanJpeg(b)
+	if info.components != 4 || info.adobe {
+		return nil, err
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(withAdobe(b)))
+	if err != nil {
+		return nil, err
+	}
+	cmyk, ok := img.(*image.CMYK)
+	if !ok {
+		return img, nil
+	}
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = 255 - cmyk.Pix[i]
+	}
+	return cmyk, nil
+}
+
+// ToSRGB converts the pixels into sRGB and re-encodes Data from them, so
+// everything downstream sees the colors as they were meant to look. Images
+// without a profile are assumed to be sRGB already and stay untouched.
+func (img *Image) ToSRGB() error {
+	var dst image.Image
+	switch {
+	case img.ColorSpace == CMYK || img.ColorSpace == YCCK:
+		bounds := img.img.Bounds()
+		rgba := image.NewNRGBA(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				rgba.Set(x, y, img.img.At(x, y))
+			}
+		}
+		dst = rgba
+	case img.profile != nil && img.profile.matrix != nil && img.ColorSpace != SRGB:
+		dst = img.profile.convert(img.img)
+	default:
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	form := img.Format
+	var err error
+	if form == "jpeg" {
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: 95})
+	} else {
+		// there is no webp encoder in x/image, png is lossless anyway
+		form = "png"
+		err = png.Encode(buf, dst)
+	}
+	if err != nil {
+		return err
+	}
+
+	img.img = dst
+	img.profile = nil
+	img.entropy = nil
+	img.thumb = nil
+	img.blurHash = nil
+	img.thumbHash = nil
+	img.Format = form
+	img.Data = buf.Bytes()
+	img.Size = buf.Len()
+	return nil
+}
+
 func (img *Image) trans() bool {
 	// relies on the fact that jpeg don't support transparency
 	if img.Format == "jpeg" {
@@ -86,20 +209,31 @@ func (img *Image) Entropy() float64 {
 	return entropy
 }
 
-func (img *Image) Valid(width, height int, entropy float64, trans bool) bool {
+// Rejection is why an image isn't worth storing.
+type Rejection string
+
+const (
+	TooSmall    Rejection = "too_small"
+	Transparent Rejection = "transparent"
+	LowEntropy  Rejection = "low_entropy"
+)
+
+// Reject returns why the image falls short of the bounds, empty if it
+// doesn't. Transparent images fall short unless trans is set.
+func (img *Image) Reject(width, height int, entropy float64, trans bool) Rejection {
 	if img.img.Bounds().Dx() < width || img.img.Bounds().Dy() < height {
-		return false
+		return TooSmall
 	}
 
 	if !trans {
 		if img.trans() {
-			return false
+			return Transparent
 		}
 	}
 
 	if img.Entropy() < entropy {
-		return false
+		return LowEntropy
 	}
 
-	return true
+	return ""
 }
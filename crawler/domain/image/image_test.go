@@ -1,6 +1,8 @@
 package image
 
 import (
+	"image"
+	"image/color"
 	"os"
 	"testing"
 )
@@ -175,3 +177,32 @@ func TestTrans(t *testing.T) {
 		})
 	}
 }
+
+func TestReject(t *testing.T) {
+	noisy := image.NewNRGBA(image.Rect(0, 0, 300, 300))
+	for i := range noisy.Pix {
+		noisy.Pix[i] = uint8(i * 7)
+		if i%4 == 3 {
+			noisy.Pix[i] = 255
+		}
+	}
+
+	var tests = []struct {
+		name  string
+		input *Image
+		want  Rejection
+	}{
+		{"valid", &Image{img: noisy}, ""},
+		{"too small", solid(100, 300, color.NRGBA{255, 0, 0, 255}), TooSmall},
+		{"transparent", solid(300, 300, color.NRGBA{255, 0, 0, 128}), Transparent},
+		{"low entropy", solid(300, 300, color.NRGBA{255, 0, 0, 255}), LowEntropy},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.input.Reject(300, 300, 3.0, false); got != test.want {
+				t.Errorf("got: %q, want: %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package image
+
+import (
+	"encoding/base64"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// thumbnail box filters src down so that neither side exceeds size. The
+// placeholders only keep a handful of frequencies, so hashing full
+// resolution photos would just waste time.
+func thumbnail(src image.Image, size int) *image.NRGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, int(math.Round(float64(h)*float64(size)/float64(w))))
+		} else {
+			tw, th = max(1, int(math.Round(float64(w)*float64(size)/float64(h)))), size
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := ty*h/th, max((ty+1)*h/th, ty*h/th+1)
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := tx*w/tw, max((tx+1)*w/tw, tx*w/tw+1)
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					c := color.NRGBAModel.Convert(
+						src.At(bounds.Min.X+x, bounds.Min.Y+y),
+					).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(tx, ty, color.NRGBA{
+				R: uint8(r / n),
+				G: uint8(g / n),
+				B: uint8(b / n),
+				A: uint8(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// small is the image downsampled once for both placeholders, the largest
+// ThumbHash takes.
+func (img *Image) small() *image.NRGBA {
+	if img.thumb == nil {
+		img.thumb = thumbnail(img.img, 100)
+	}
+	return img.thumb
+}
+
+// BlurHash returns the BlurHash of the image with 4x3 components.
+func (img *Image) BlurHash() string {
+	if img.blurHash != nil {
+		return *img.blurHash
+	}
+	hash := blurHash(thumbnail(img.small(), 64), 4, 3)
+	img.blurHash = &hash
+	return hash
+}
+
+// ThumbHash returns the base64 encoded ThumbHash of the image.
+func (img *Image) ThumbHash() string {
+	if img.thumbHash != nil {
+		return *img.thumbHash
+	}
+	hash := base64.StdEncoding.EncodeToString(thumbHash(img.small()))
+	img.thumbHash = &hash
+	return hash
+}
+
+func srgbToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func encode83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(base83[digit])
+	}
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// blurHash follows the reference encoder at https://blurha.sh
+func blurHash(img *image.NRGBA, xComp, yComp int) string {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+
+	lin := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.NRGBAAt(x, y)
+			lin[y*w+x] = [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComp*yComp)
+	for j := 0; j < yComp; j++ {
+		for i := 0; i < xComp; i++ {
+			norm := 2.0
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := norm *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					p := lin[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	sb := &strings.Builder{}
+	encode83(sb, (xComp-1)+(yComp-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantMax+1) / 166
+		encode83(sb, quantMax, 1)
+	} else {
+		encode83(sb, 0, 1)
+	}
+
+	encode83(sb, linearToSrgb(dc[0])<<16+linearToSrgb(dc[1])<<8+linearToSrgb(dc[2]), 4)
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		encode83(sb, quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2)
+	}
+
+	return sb.String()
+}
+
+func round(v float64) int {
+	return int(math.Floor(v + 0.5))
+}
+
+// thumbHash follows the reference encoder at https://evanw.github.io/thumbhash,
+// img must not exceed 100x100.
+func thumbHash(img *image.NRGBA) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	n := w * h
+
+	var avgR, avgG, avgB, avgA float64
+	for i := 0; i < n; i++ {
+		c := img.Pix[i*4 : i*4+4]
+		alpha := float64(c[3]) / 255
+		avgR += alpha / 255 * float64(c[0])
+		avgG += alpha / 255 * float64(c[1])
+		avgB += alpha / 255 * float64(c[2])
+		avgA += alpha
+	}
+	if avgA > 0 {
+		avgR /= avgA
+		avgG /= avgA
+		avgB /= avgA
+	}
+
+	hasAlpha := avgA < float64(n)
+	limit := 7.0
+	if hasAlpha {
+		// fewer luminance bits to make room for alpha
+		limit = 5
+	}
+	lx := max(1, round(limit*float64(w)/float64(max(w, h))))
+	ly := max(1, round(limit*float64(h)/float64(max(w, h))))
+
+	// LPQA: luminance, yellow-blue, red-green, alpha, composited atop the
+	// average color
+	l, p, q, a := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		c := img.Pix[i*4 : i*4+4]
+		alpha := float64(c[3]) / 255
+		r := avgR*(1-alpha) + alpha/255*float64(c[0])
+		g := avgG*(1-alpha) + alpha/255*float64(c[1])
+		b := avgB*(1-alpha) + alpha/255*float64(c[2])
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+
+	encode := func(channel []float64, nx, ny int) (float64, []float64, float64) {
+		dc, scale := 0.0, 0.0
+		ac := []float64{}
+		fx := make([]float64, w)
+		for cy := 0; cy < ny; cy++ {
+			for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+				f := 0.0
+				for x := 0; x < w; x++ {
+					fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+				}
+				for y := 0; y < h; y++ {
+					fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+					for x := 0; x < w; x++ {
+						f += channel[x+y*w] * fx[x] * fy
+					}
+				}
+				f /= float64(n)
+				if cx > 0 || cy > 0 {
+					ac = append(ac, f)
+					scale = math.Max(scale, math.Abs(f))
+				} else {
+					dc = f
+				}
+			}
+		}
+		if scale > 0 {
+			for i := range ac {
+				ac[i] = 0.5 + 0.5/scale*ac[i]
+			}
+		}
+		return dc, ac, scale
+	}
+
+	lDC, lAC, lScale := encode(l, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := encode(p, 3, 3)
+	qDC, qAC, qScale := encode(q, 3, 3)
+
+	landscape := 0
+	if w > h {
+		landscape = 1
+	}
+	alphaBit := 0
+	if hasAlpha {
+		alphaBit = 1
+	}
+	header24 := round(63*lDC) | round(31.5+31.5*pDC)<<6 | round(31.5+31.5*qDC)<<12 |
+		round(31*lScale)<<18 | alphaBit<<23
+	header16 := ly
+	if landscape == 0 {
+		header16 = lx
+	}
+	header16 |= round(63*pScale)<<3 | round(63*qScale)<<9 | landscape<<15
+
+	hash := []byte{
+		byte(header24), byte(header24 >> 8), byte(header24 >> 16),
+		byte(header16), byte(header16 >> 8),
+	}
+	channels := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		aDC, aAC, aScale := encode(a, 5, 5)
+		hash = append(hash, byte(round(15*aDC)|round(15*aScale)<<4))
+		channels = append(channels, aAC)
+	}
+
+	start, index := len(hash), 0
+	for _, ac := range channels {
+		for _, f := range ac {
+			pos := start + index>>1
+			if pos >= len(hash) {
+				hash = append(hash, 0)
+			}
+			hash[pos] |= byte(round(15*f) << ((index & 1) << 2))
+			index++
+		}
+	}
+
+	return hash
+}
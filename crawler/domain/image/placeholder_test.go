@@ -0,0 +1,115 @@
+package image
+
+import (
+	"encoding/base64"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func solid(w, h int, c color.NRGBA) *Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return &Image{Width: w, Height: h, img: img}
+}
+
+func TestBlurHash(t *testing.T) {
+	got := solid(300, 200, color.NRGBA{255, 0, 0, 255}).BlurHash()
+	// the reference basis samples at x/w instead of pixel centers, so even a
+	// solid image gets small AC components
+	want := "L7TI:j;$fQ;$|cjtfQjtfQfQfQfQ"
+	if got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	b, err := loadTestData("../../test/non-trans.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	img, err := Load(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(img.BlurHash()) != 28 {
+		t.Errorf("got length: %d, want: 28", len(img.BlurHash()))
+	}
+}
+
+func TestThumbHash(t *testing.T) {
+	var tests = []struct {
+		name      string
+		input     *Image
+		landscape bool
+		alpha     bool
+	}{
+		{
+			"landscape opaque",
+			solid(200, 100, color.NRGBA{255, 0, 0, 255}),
+			true,
+			false,
+		},
+		{
+			"portrait transparent",
+			solid(50, 120, color.NRGBA{255, 0, 0, 128}),
+			false,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := base64.StdEncoding.DecodeString(test.input.ThumbHash())
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if len(hash) < 6 {
+				t.Errorf("hash too short: %d bytes", len(hash))
+				return
+			}
+
+			header24 := int(hash[0]) | int(hash[1])<<8 | int(hash[2])<<16
+			header16 := int(hash[3]) | int(hash[4])<<8
+			if got := header16>>15 == 1; got != test.landscape {
+				t.Errorf("got landscape: %t, want: %t", got, test.landscape)
+			}
+			if got := header24>>23 == 1; got != test.alpha {
+				t.Errorf("got alpha: %t, want: %t", got, test.alpha)
+			}
+
+			// solid red is l = 1/3, p = 1/2, q = 1 in LPQ
+			l := float64(header24&63) / 63
+			p := float64(header24>>6&63)/31.5 - 1
+			q := float64(header24>>12&63)/31.5 - 1
+			if math.Abs(l-1.0/3) > 0.02 || math.Abs(p-0.5) > 0.04 || math.Abs(q-1) > 0.04 {
+				t.Errorf("unexpected average color l: %f, p: %f, q: %f", l, p, q)
+			}
+		})
+	}
+}
+
+// countingImage counts the pixels read from it.
+type countingImage struct {
+	image.Image
+	reads int
+}
+
+func (c *countingImage) At(x, y int) color.Color {
+	c.reads++
+	return c.Image.At(x, y)
+}
+
+func TestPlaceholdersDownsampleOnce(t *testing.T) {
+	src := &countingImage{Image: solid(300, 200, color.NRGBA{255, 0, 0, 255}).img}
+	img := &Image{Width: 300, Height: 200, img: src}
+	img.BlurHash()
+	img.ThumbHash()
+	if src.reads != 300*200 {
+		t.Errorf("got reads: %d, want: %d", src.reads, 300*200)
+	}
+}
@@ -0,0 +1,77 @@
+package page
+
+import "time"
+
+const (
+	// DefaultInterval is how long a page waits for its first revisit.
+	DefaultInterval = 24 * time.Hour
+	MinInterval     = time.Hour
+	MaxInterval     = 30 * 24 * time.Hour
+)
+
+// Page is what the crawler remembers about an html page to decide when to
+// fetch it again and to ask the server whether it changed since.
+type Page struct {
+	Hash         string
+	Url          string
+	Seed         string // the seed the page was found from
+	Depth        int    // links away from the seed
+	ETag         string
+	LastModified string
+	ContentHash  string
+	FetchedAt    time.Time
+	NextFetch    time.Time
+	Interval     time.Duration
+	Fetches      int
+	Changes      int
+	Failures     int // failed fetches since the last one that succeeded
+}
+
+func New(hash, url string) *Page {
+	return &Page{Hash: hash, Url: url, Interval: DefaultInterval}
+}
+
+// Fetched records a fetch at now and schedules the next one. Pages that
+// changed since the last fetch are revisited twice as soon, pages that
+// didn't half as soon again, within MinInterval and MaxInterval.
+func (p *Page) Fetched(now time.Time, changed bool) {
+	if p.Interval <= 0 {
+		p.Interval = DefaultInterval
+	}
+	if p.Fetches > 0 {
+		if changed {
+			p.Interval /= 2
+		} else {
+			p.Interval = p.Interval * 3 / 2
+		}
+	}
+	if p.Interval < MinInterval {
+		p.Interval = MinInterval
+	}
+	if p.Interval > MaxInterval {
+		p.Interval = MaxInterval
+	}
+
+	p.Fetches++
+	p.Failures = 0
+	if changed {
+		p.Changes++
+	}
+	p.FetchedAt = now
+	p.NextFetch = now.Add(p.Interval)
+}
+
+// FetchFailed records a failed fetch at now. The next fetch waits
+// MinInterval, doubled with every failure in a row up to MaxInterval, so a
+// page that is gone isn't fetched again on every revisit.
+func (p *Page) FetchFailed(now time.Time) {
+	p.Failures++
+	backoff := MinInterval
+	for i := 1; i < p.Failures && backoff < MaxInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxInterval {
+		backoff = MaxInterval
+	}
+	p.NextFetch = now.Add(backoff)
+}
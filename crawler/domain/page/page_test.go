@@ -0,0 +1,71 @@
+package page
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFetched(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := New("ofiwjefwoiefj", "https://example.com/")
+
+	// the first fetch has nothing to compare against
+	p.Fetched(now, true)
+	if p.Interval != DefaultInterval || !p.NextFetch.Equal(now.Add(DefaultInterval)) {
+		t.Errorf("unexpected schedule after first fetch: %v, %v", p.Interval, p.NextFetch)
+	}
+
+	p.Fetched(now, true)
+	if p.Interval != DefaultInterval/2 {
+		t.Errorf("got interval: %v, want: %v", p.Interval, DefaultInterval/2)
+	}
+	p.Fetched(now, false)
+	if p.Interval != DefaultInterval*3/4 {
+		t.Errorf("got interval: %v, want: %v", p.Interval, DefaultInterval*3/4)
+	}
+
+	for i := 0; i < 20; i++ {
+		p.Fetched(now, true)
+	}
+	if p.Interval != MinInterval {
+		t.Errorf("got interval: %v, want: %v", p.Interval, MinInterval)
+	}
+	for i := 0; i < 20; i++ {
+		p.Fetched(now, false)
+	}
+	if p.Interval != MaxInterval {
+		t.Errorf("got interval: %v, want: %v", p.Interval, MaxInterval)
+	}
+	if p.Fetches != 43 || p.Changes != 22 {
+		t.Errorf("got fetches: %d, changes: %d", p.Fetches, p.Changes)
+	}
+}
+
+func TestFetchFailed(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := New("ofiwjefwoiefj", "https://example.com/")
+	p.Fetched(now, true)
+
+	p.FetchFailed(now)
+	if p.Failures != 1 || !p.NextFetch.Equal(now.Add(MinInterval)) {
+		t.Errorf("unexpected schedule after first failure: %d, %v", p.Failures, p.NextFetch)
+	}
+	p.FetchFailed(now)
+	if !p.NextFetch.Equal(now.Add(2 * MinInterval)) {
+		t.Errorf("got next fetch: %v, want: %v", p.NextFetch, now.Add(2*MinInterval))
+	}
+	for i := 0; i < 20; i++ {
+		p.FetchFailed(now)
+	}
+	if !p.NextFetch.Equal(now.Add(MaxInterval)) {
+		t.Errorf("got next fetch: %v, want: %v", p.NextFetch, now.Add(MaxInterval))
+	}
+	if p.Interval != DefaultInterval || p.Fetches != 1 || !p.FetchedAt.Equal(now) {
+		t.Errorf("failures changed the schedule: %+v", p)
+	}
+
+	p.Fetched(now, false)
+	if p.Failures != 0 {
+		t.Errorf("got failures: %d, want: 0", p.Failures)
+	}
+}
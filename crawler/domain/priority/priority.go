@@ -0,0 +1,76 @@
+package priority
+
+import "strings"
+
+// Max is the highest priority, the queue hands out items with a higher
+// priority first.
+const Max = 9
+
+// Signals is what is known about a url before it is fetched.
+type Signals struct {
+	Image     bool
+	Depth     int    // links away from the seed
+	HostYield int    // images accepted from pages on the host so far
+	Width     int    // declared by srcset or the width attribute, 0 is unknown
+	Anchor    string // text of the link
+}
+
+var (
+	goodWords = []string{
+		"gallery", "galleries", "photo", "image", "picture", "album",
+		"wallpaper", "portfolio", "artwork", "collection",
+	}
+	badWords = []string{
+		"login", "log in", "sign in", "signup", "sign up", "register",
+		"privacy", "terms", "cookie", "cart", "checkout", "imprint",
+	}
+)
+
+// Score ranks a url between 0 and Max. Images come before pages, since they
+// are what the crawl is after, and both move up with the yield of their host.
+// Large images move up further, pages move down with depth and up or down
+// with the words of their anchor.
+func Score(s *Signals) uint8 {
+	score := 3
+	if s.Image {
+		score = 6
+		switch {
+		case s.Width >= 1024:
+			score += 2
+		case s.Width >= 512:
+			score += 1
+		case s.Width > 0 && s.Width < 300:
+			// too small to be kept
+			score -= 3
+		}
+	} else {
+		score -= min(s.Depth/2, 2)
+		anchor := strings.ToLower(s.Anchor)
+		if containsAny(anchor, goodWords) {
+			score += 2
+		}
+		if containsAny(anchor, badWords) {
+			score -= 2
+		}
+	}
+
+	switch {
+	case s.HostYield >= 100:
+		score += 3
+	case s.HostYield >= 10:
+		score += 2
+	case s.HostYield > 0:
+		score += 1
+	}
+
+	return uint8(max(0, min(score, Max)))
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package priority
+
+import "testing"
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		signals *Signals
+		want    uint8
+	}{
+		{&Signals{}, 3},
+		{&Signals{Depth: 4}, 1},
+		{&Signals{Depth: 9}, 1},
+		{&Signals{Anchor: "Photo Gallery"}, 5},
+		{&Signals{Anchor: "Log in"}, 1},
+		{&Signals{Depth: 6, Anchor: "Privacy"}, 0},
+		{&Signals{HostYield: 5}, 4},
+		{&Signals{Image: true}, 6},
+		{&Signals{Image: true, Width: 800}, 7},
+		{&Signals{Image: true, Width: 100}, 3},
+		{&Signals{Image: true, Width: 2048, HostYield: 1000}, Max},
+	}
+
+	for _, test := range tests {
+		if got := Score(test.signals); got != test.want {
+			t.Errorf("got score: %d, want: %d, for: %+v", got, test.want, test.signals)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package scope
+
+import (
+	"encoding/json"
+	"fmt"
+	gourl "net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+type Mode string
+
+const (
+	// Host only follows links on the host of the seed.
+	Host Mode = "host"
+	// Domain follows links on every host of the registrable domain of the
+	// seed, like "example.co.uk" for "www.example.co.uk".
+	Domain Mode = "domain"
+	Any    Mode = "any"
+)
+
+// Scope decides which links found from a seed are crawled. Images are what
+// the crawl is after and often live on other hosts, so they are only held
+// against the exclude rules.
+type Scope struct {
+	Mode            Mode     `json:"mode"`
+	IncludeHosts    []string `json:"include_hosts"` // globs like "*.example.com"
+	ExcludeHosts    []string `json:"exclude_hosts"`
+	IncludePaths    []string `json:"include_paths"` // regular expressions
+	ExcludePaths    []string `json:"exclude_paths"`
+	MaxDepth        int      `json:"max_depth"`          // links away from the seed, 0 is unlimited
+	MaxPagesPerHost int      `json:"max_pages_per_host"` // 0 is unlimited
+
+	includePaths []*regexp.Regexp
+	excludePaths []*regexp.Regexp
+}
+
+// Config holds the scope of every seed and the one for seeds without their
+// own.
+type Config struct {
+	Default *Scope            `json:"default"`
+	Seeds   map[string]*Scope `json:"seeds"`
+}
+
+func Load(file string) (*Config, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Default == nil {
+		cfg.Default = &Scope{Mode: Any}
+	}
+	if err := cfg.Default.Compile(); err != nil {
+		return nil, err
+	}
+	for seed, s := range cfg.Seeds {
+		if err := s.Compile(); err != nil {
+			return nil, fmt.Errorf("scope of seed '%s': %w", seed, err)
+		}
+	}
+	return cfg, nil
+}
+
+// For returns the scope of seed. A nil config allows everything.
+func (cfg *Config) For(seed string) *Scope {
+	if cfg == nil {
+		return &Scope{Mode: Any}
+	}
+	if s, ok := cfg.Seeds[seed]; ok {
+		return s
+	}
+	return cfg.Default
+}
+
+// Compile checks the patterns of s, it has to run before s is used.
+func (s *Scope) Compile() error {
+	switch s.Mode {
+	case "":
+		s.Mode = Any
+	case Host, Domain, Any:
+	default:
+		return fmt.Errorf("unknown mode '%s'", s.Mode)
+	}
+
+	for _, glob := range append(append([]string{}, s.IncludeHosts...), s.ExcludeHosts...) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("host glob '%s': %w", glob, err)
+		}
+	}
+
+	s.includePaths = s.includePaths[:0]
+	s.excludePaths = s.excludePaths[:0]
+	for _, expr := range s.IncludePaths {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		s.includePaths = append(s.includePaths, re)
+	}
+	for _, expr := range s.ExcludePaths {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		s.excludePaths = append(s.excludePaths, re)
+	}
+	return nil
+}
+
+func matchHost(globs []string, host string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(exprs []*regexp.Regexp, p string) bool {
+	for _, re := range exprs {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func registrable(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// ip addresses and bare suffixes only match themselves
+		return host
+	}
+	return domain
+}
+
+func excluded(s *Scope, url *gourl.URL) bool {
+	if url.Scheme != "http" && url.Scheme != "https" {
+		return true
+	}
+	host := strings.ToLower(url.Hostname())
+	return matchHost(s.ExcludeHosts, host) || matchPath(s.excludePaths, url.Path)
+}
+
+// Link reports whether the page at url, depth links away from seed, is in
+// scope.
+func (s *Scope) Link(seed, url *gourl.URL, depth int) bool {
+	if excluded(s, url) {
+		return false
+	}
+	if s.MaxDepth > 0 && depth > s.MaxDepth {
+		return false
+	}
+
+	host := strings.ToLower(url.Hostname())
+	seedHost := strings.ToLower(seed.Hostname())
+	switch s.Mode {
+	case Host:
+		if host != seedHost {
+			return false
+		}
+	case Domain:
+		if registrable(host) != registrable(seedHost) {
+			return false
+		}
+	}
+
+	if len(s.IncludeHosts) > 0 && !matchHost(s.IncludeHosts, host) {
+		return false
+	}
+	if len(s.includePaths) > 0 && !matchPath(s.includePaths, url.Path) {
+		return false
+	}
+	return true
+}
+
+// Image reports whether the image at url is in scope.
+func (s *Scope) Image(url *gourl.URL) bool {
+	return !excluded(s, url)
+}
@@ -0,0 +1,90 @@
+package scope
+
+import (
+	gourl "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	seed, _ := gourl.Parse("https://www.example.co.uk/gallery/")
+
+	tests := []struct {
+		scope *Scope
+		url   string
+		depth int
+		want  bool
+	}{
+		{&Scope{Mode: Any}, "https://other.org/", 1, true},
+		{&Scope{Mode: Any}, "mailto:someone@example.co.uk", 1, false},
+		{&Scope{Mode: Host}, "https://www.example.co.uk/about", 1, true},
+		{&Scope{Mode: Host}, "https://img.example.co.uk/", 1, false},
+		{&Scope{Mode: Domain}, "https://img.example.co.uk/", 1, true},
+		{&Scope{Mode: Domain}, "https://other.co.uk/", 1, false},
+		{&Scope{Mode: Any, MaxDepth: 2}, "https://other.org/", 2, true},
+		{&Scope{Mode: Any, MaxDepth: 2}, "https://other.org/", 3, false},
+		{&Scope{Mode: Any, IncludeHosts: []string{"*.example.org"}}, "https://a.example.org/", 1, true},
+		{&Scope{Mode: Any, IncludeHosts: []string{"*.example.org"}}, "https://example.org/", 1, false},
+		{&Scope{Mode: Any, ExcludeHosts: []string{"ads.*"}}, "https://ads.example.org/", 1, false},
+		{&Scope{Mode: Host, IncludePaths: []string{"^/gallery/"}}, "https://www.example.co.uk/gallery/2", 1, true},
+		{&Scope{Mode: Host, IncludePaths: []string{"^/gallery/"}}, "https://www.example.co.uk/shop", 1, false},
+		{&Scope{Mode: Host, ExcludePaths: []string{`\.pdf$`}}, "https://www.example.co.uk/a.pdf", 1, false},
+	}
+
+	for _, test := range tests {
+		if err := test.scope.Compile(); err != nil {
+			t.Fatal(err.Error())
+		}
+		url, _ := gourl.Parse(test.url)
+		if got := test.scope.Link(seed, url, test.depth); got != test.want {
+			t.Errorf("got: %t, want: %t, for: %s with %+v", got, test.want, test.url, test.scope)
+		}
+	}
+
+	// images are only held against the exclude rules
+	s := &Scope{Mode: Host, MaxDepth: 1, ExcludeHosts: []string{"ads.*"}}
+	if err := s.Compile(); err != nil {
+		t.Fatal(err.Error())
+	}
+	img, _ := gourl.Parse("https://cdn.other.org/a.png")
+	if !s.Image(img) {
+		t.Error("image on another host out of scope")
+	}
+	img, _ = gourl.Parse("https://ads.other.org/a.png")
+	if s.Image(img) {
+		t.Error("image on excluded host in scope")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "scope.json")
+	err := os.WriteFile(file, []byte(`{
+		"default": {"mode": "host", "max_depth": 3},
+		"seeds": {"https://example.org/": {"mode": "domain", "exclude_paths": ["^/private"]}}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s := cfg.For("https://other.org/"); s.Mode != Host || s.MaxDepth != 3 {
+		t.Errorf("unexpected default scope: %+v", s)
+	}
+	s := cfg.For("https://example.org/")
+	seed, _ := gourl.Parse("https://example.org/")
+	url, _ := gourl.Parse("https://www.example.org/private/a")
+	if s.Mode != Domain || s.Link(seed, url, 1) {
+		t.Errorf("unexpected seed scope: %+v", s)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"default": {"exclude_paths": ["("]}}`), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := Load(file); err == nil {
+		t.Error("loaded an invalid path pattern")
+	}
+}
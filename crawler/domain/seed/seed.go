@@ -0,0 +1,67 @@
+package seed
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	gourl "net/url"
+	"strings"
+
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
+)
+
+// Seed is a url the crawl starts from. Its scope and budget apply to every
+// page found from it, a nil scope falls back to the configured one.
+type Seed struct {
+	Url     string       `json:"url"`
+	Scope   *scope.Scope `json:"scope,omitempty"`
+	Budget  int          `json:"budget,omitempty"` // pages queued from the seed, 0 is unlimited
+	Removed bool         `json:"-"`
+}
+
+// Validate checks the url and scope of s and normalizes the url.
+func (s *Seed) Validate() error {
+	u, err := gourl.Parse(s.Url)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) < 1 {
+		return fmt.Errorf("seed '%s' is not an absolute http url", s.Url)
+	}
+	if s.Budget < 0 {
+		return fmt.Errorf("seed '%s' has a negative budget", s.Url)
+	}
+	s.Url = u.String()
+	if s.Scope != nil {
+		return s.Scope.Compile()
+	}
+	return nil
+}
+
+// Parse reads one seed per line, either a bare url or a json object with
+// url, scope and budget. Blank lines and lines starting with # are skipped.
+func Parse(r io.Reader) ([]*Seed, error) {
+	seeds := []*Seed{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		s := &Seed{Url: line}
+		if strings.HasPrefix(line, "{") {
+			s = &Seed{}
+			if err := json.Unmarshal([]byte(line), s); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		}
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		seeds = append(seeds, s)
+	}
+	return seeds, scanner.Err()
+}
@@ -0,0 +1,40 @@
+package seed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
+)
+
+func TestParse(t *testing.T) {
+	seeds, err := Parse(strings.NewReader(`
+# galleries
+https://example.com/gallery
+{"url": "https://example.org/", "scope": {"mode": "domain", "max_depth": 2}, "budget": 100}
+
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(seeds) != 2 {
+		t.Fatalf("got %d seeds, want: 2", len(seeds))
+	}
+	if seeds[0].Url != "https://example.com/gallery" || seeds[0].Scope != nil {
+		t.Errorf("unexpected seed: %+v", seeds[0])
+	}
+	if seeds[1].Budget != 100 || seeds[1].Scope.Mode != scope.Domain || seeds[1].Scope.MaxDepth != 2 {
+		t.Errorf("unexpected seed: %+v", seeds[1])
+	}
+
+	for _, input := range []string{
+		"example.com",
+		"ftp://example.com/",
+		`{"url": "https://example.com/", "scope": {"mode": "nowhere"}}`,
+		`{"url": "https://example.com/", "budget": -1}`,
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("parsed invalid seed: %s", input)
+		}
+	}
+}
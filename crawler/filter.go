@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/bloom"
+)
+
+// newFilter loads the visited filter from its last snapshot at BLOOM_PATH or
+// rebuilds it from the visited table. A stale snapshot is fine, urls missing
+// from it only go to the database like they would without a filter.
+func newFilter(db database.Database) (*bloom.Filter, error) {
+	path := os.Getenv("BLOOM_PATH")
+	if len(path) > 0 {
+		file, err := os.Open(path)
+		if err == nil {
+			defer file.Close()
+			return bloom.Load(file)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	capacity, err := strconv.ParseUint(envOrDefault("BLOOM_CAPACITY", "10000000"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := strconv.ParseFloat(envOrDefault("BLOOM_FP", "0.001"), 64)
+	if err != nil {
+		return nil, err
+	}
+	filter := bloom.New(capacity, fp)
+	err = db.Urls(func(hash string) error {
+		filter.Add(hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// snapshotFilter writes the filter to BLOOM_PATH every BLOOM_SNAPSHOT until
+// the process exits.
+func snapshotFilter(filter *bloom.Filter) error {
+	path := os.Getenv("BLOOM_PATH")
+	if len(path) < 1 {
+		return nil
+	}
+	interval, err := time.ParseDuration(envOrDefault("BLOOM_SNAPSHOT", "5m"))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := writeSnapshot(filter, path); err != nil {
+				slog.Warn("writing the bloom filter snapshot failed", "path", path, "err", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// writeSnapshot replaces the snapshot at once, a crash midway leaves the
+// previous one intact.
+func writeSnapshot(filter *bloom.Filter, path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := filter.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
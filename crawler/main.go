@@ -1,70 +1,311 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	gourl "net/url"
+	"log/slog"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache"
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/client"
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/embedded"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/tracing"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
 	"github.com/kfc-manager/vision-seeker/crawler/service/crawler"
 	"github.com/kfc-manager/vision-seeker/crawler/service/data"
+	"github.com/kfc-manager/vision-seeker/crawler/service/health"
+	"github.com/kfc-manager/vision-seeker/crawler/service/scheduler"
 )
 
 func main() {
-	db, err := database.New(
-		envOrPanic("DB_HOST"),
-		envOrPanic("DB_PORT"),
-		envOrPanic("DB_NAME"),
-		envOrPanic("DB_USER"),
-		envOrPanic("DB_PASS"),
-	)
+	logger, err := newLogger()
 	if err != nil {
 		panic(err)
 	}
+	// the adapters log to the default logger
+	slog.SetDefault(logger)
 
-	cach, err := cache.New(
-		envOrPanic("CACHE_HOST"),
-		envOrPanic("CACHE_PORT"),
-		envOrPanic("CACHE_PASS"),
-	)
+	cmd := "crawl"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	switch cmd {
+	case "crawl":
+		crawl()
+	case "migrate-bucket":
+		migrateBucket()
+	case "verify-bucket":
+		verifyBucket(os.Args[2:])
+	case "migrate":
+		migrate(os.Args[2:])
+	case "seed":
+		seedCmd(os.Args[2:])
+	case "dead-letters":
+		deadLetters(os.Args[2:])
+	case "api":
+		apiCmd()
+	case "upgrade-queue":
+		upgradeQueue()
+	default:
+		panic(fmt.Errorf("unknown command '%s'", cmd))
+	}
+}
+
+func crawl() {
+	shutdown, err := tracing.Setup(envOrDefault("TRACE_EXPORTER", "none"))
 	if err != nil {
 		panic(err)
 	}
+	defer func() {
+		if err := shutdown(); err != nil {
+			slog.Error("flushing spans failed", "err", err)
+		}
+	}()
 
-	buck, err := bucket.New(
-		envOrPanic("BUCKET_PATH"),
-	)
+	db, cach, que, err := newStores()
 	if err != nil {
 		panic(err)
 	}
 
-	que, err := queue.New(
-		envOrPanic("QUEUE_HOST"),
-		envOrPanic("QUEUE_PORT"),
-		envOrPanic("URL_QUEUE_NAME"),
-		100000000,
+	buck, err := newBucket()
+	if err != nil {
+		panic(err)
+	}
+	if err := health.Wait("bucket", readyTimeout(), writable(buck)); err != nil {
+		panic(err)
+	}
+
+	filter, err := newFilter(db)
+	if err != nil {
+		panic(err)
+	}
+	if err := snapshotFilter(filter); err != nil {
+		panic(err)
+	}
+
+	var scopes *scope.Config
+	if file := os.Getenv("SCOPE_FILE"); len(file) > 0 {
+		scopes, err = scope.Load(file)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if err := metrics.QueueDepth(que.Len); err != nil {
+		panic(err)
+	}
+	checks := health.New()
+	checks.Ready("database", db.Ping)
+	checks.Ready("cache", cach.Ping)
+	checks.Ready("queue", que.Ping)
+	checks.Ready("bucket", writable(buck))
+	startServer(checks)
+
+	dataServ := data.New(
+		database.NewMeasured(db),
+		cache.NewFiltered(cache.NewMeasured(cach), filter),
+		bucket.NewSharded(bucket.NewMeasured(buck)),
+		que,
+		scopes,
+		slog.Default(),
 	)
+	if err := dataServ.Recover(); err != nil {
+		panic(err)
+	}
+	seeds, err := startSeeds()
 	if err != nil {
 		panic(err)
 	}
+	if err := addSeeds(dataServ, seeds, envOrDefault("SEED_FORCE", "false") == "true"); err != nil {
+		panic(err)
+	}
+
+	if envOrDefault("RECRAWL", "true") == "true" {
+		every, err := time.ParseDuration(envOrDefault("RECRAWL_EVERY", "1m"))
+		if err != nil {
+			panic(err)
+		}
+		lease, err := time.ParseDuration(envOrDefault("RECRAWL_LEASE", "24h"))
+		if err != nil {
+			panic(err)
+		}
+		go scheduler.New(dataServ, every, lease, 1000, slog.Default()).Run()
+	}
 
-	time.Sleep(5 * time.Second)
-	dataServ := data.New(db, cach, buck, que)
-	url, err := gourl.Parse(envOrPanic("START"))
+	crawlServ := crawler.New(
+		client.New(),
+		dataServ,
+		envOrDefault("SRGB", "false") == "true",
+		slog.Default(),
+	)
+	stuckAfter, err := time.ParseDuration(envOrDefault("CRAWL_STUCK_AFTER", "5m"))
 	if err != nil {
 		panic(err)
 	}
-	err = dataServ.Visit(url, "")
+	checks.Live("crawl", func() error { return crawlServ.Progress(stuckAfter) })
+	crawlServ.Crawl()
+}
+
+func databaseEnv() (string, string, string, string, string) {
+	return envOrPanic("DB_HOST"),
+		envOrPanic("DB_PORT"),
+		envOrPanic("DB_NAME"),
+		envOrPanic("DB_USER"),
+		envOrPanic("DB_PASS")
+}
+
+// queueEnv reads the broker from QUEUE_URL, or from QUEUE_HOST and the
+// optional settings next to it when there is none.
+func queueEnv() *queue.Config {
+	cfg := &queue.Config{
+		Url:      os.Getenv("QUEUE_URL"),
+		Port:     os.Getenv("QUEUE_PORT"),
+		User:     os.Getenv("QUEUE_USER"),
+		Password: os.Getenv("QUEUE_PASS"),
+		Vhost:    os.Getenv("QUEUE_VHOST"),
+		TLS:      envOrDefault("QUEUE_TLS", "false") == "true",
+		CAFile:   os.Getenv("QUEUE_CA_FILE"),
+		CertFile: os.Getenv("QUEUE_CERT_FILE"),
+		KeyFile:  os.Getenv("QUEUE_KEY_FILE"),
+		ConnName: envOrDefault("QUEUE_CONN_NAME", "crawler"),
+	}
+	if len(cfg.Url) < 1 {
+		cfg.Host = envOrPanic("QUEUE_HOST")
+	}
+	return cfg
+}
+
+// standalone keeps the visited set, the frontier and the image metadata in a
+// single embedded store at the path in STANDALONE instead of Postgres, Redis
+// and RabbitMQ. Images still go to the bucket.
+func standalone() bool {
+	return len(os.Getenv("STANDALONE")) > 0
+}
+
+// readyTimeout is how long to wait for a dependency at startup.
+func readyTimeout() time.Duration {
+	timeout, err := time.ParseDuration(envOrDefault("READY_TIMEOUT", "2m"))
 	if err != nil {
 		panic(err)
 	}
+	return timeout
+}
+
+// maxQueue is the length past which new urls are dropped.
+const maxQueue = 100000000
 
-	crawler.New(client.New(), dataServ).Crawl()
+// newStores opens the standalone store once for all three, a second open
+// of the same file would block on its lock.
+func newStores() (database.Database, cache.Cache, queue.Queue, error) {
+	if standalone() {
+		store, err := embedded.Open(os.Getenv("STANDALONE"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return store.Database(), store.Cache(), store.Queue(maxQueue), nil
+	}
+
+	db, err := newDatabase()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var cach cache.Cache
+	err = health.Wait("cache", readyTimeout(), func() (err error) {
+		cach, err = cache.New(
+			envOrPanic("CACHE_HOST"),
+			envOrPanic("CACHE_PORT"),
+			envOrPanic("CACHE_PASS"),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	prefetch, err := strconv.Atoi(envOrDefault("QUEUE_PREFETCH", "1"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	que, err := queue.New(queueEnv(), envOrPanic("URL_QUEUE_NAME"), maxQueue, prefetch)
+	// no retry makes a queue of an older version fit, upgrade-queue does
+	if errors.Is(err, queue.ErrIncompatible) {
+		return nil, nil, nil, err
+	}
+	if err != nil {
+		err = health.Wait("queue", readyTimeout(), func() (err error) {
+			que, err = queue.New(queueEnv(), envOrPanic("URL_QUEUE_NAME"), maxQueue, prefetch)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return db, cach, que, nil
+}
+
+func newDatabase() (database.Database, error) {
+	if standalone() {
+		store, err := embedded.Open(os.Getenv("STANDALONE"))
+		if err != nil {
+			return nil, err
+		}
+		return store.Database(), nil
+	}
+
+	db, err := database.New(databaseEnv())
+	if err != nil {
+		err = health.Wait("database", readyTimeout(), func() (err error) {
+			db, err = database.New(databaseEnv())
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if envOrDefault("DB_MIGRATE", "true") == "true" {
+		if err := db.Migrate(); err != nil {
+			return nil, err
+		}
+	}
+
+	window, err := time.ParseDuration(envOrDefault("DB_BATCH_WINDOW", "5ms"))
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		return db, nil
+	}
+	size, err := strconv.Atoi(envOrDefault("DB_BATCH_SIZE", "256"))
+	if err != nil {
+		return nil, err
+	}
+	return database.NewBatcher(db, window, size), nil
+}
+
+func newBucket() (bucket.Bucket, error) {
+	switch t := envOrDefault("BUCKET_TYPE", "local"); t {
+	case "local":
+		return bucket.NewLocal(
+			envOrPanic("BUCKET_PATH"),
+			envOrDefault("BUCKET_FSYNC", "false") == "true",
+		)
+	case "s3":
+		return bucket.NewS3(
+			envOrPanic("S3_ENDPOINT"),
+			envOrDefault("S3_REGION", "us-east-1"),
+			envOrPanic("S3_BUCKET"),
+			envOrPanic("S3_ACCESS_KEY"),
+			envOrPanic("S3_SECRET_KEY"),
+		)
+	default:
+		return nil, fmt.Errorf("unknown bucket type '%s'", t)
+	}
 }
 
 func envOrPanic(key string) string {
@@ -74,3 +315,11 @@ func envOrPanic(key string) string {
 	}
 	return val
 }
+
+func envOrDefault(key, def string) string {
+	val := os.Getenv(key)
+	if len(val) < 1 {
+		return def
+	}
+	return val
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/client"
+	"github.com/kfc-manager/vision-seeker/crawler/service/maintenance"
+)
+
+func migrateBucket() {
+	buck, err := newBucket()
+	if err != nil {
+		panic(err)
+	}
+
+	report, err := maintenance.New(nil, buck, nil).MigrateLayout()
+	if err != nil {
+		panic(err)
+	}
+
+	printReport(report)
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func verifyBucket(args []string) {
+	opts := &maintenance.VerifyOptions{}
+	flags := flag.NewFlagSet("verify-bucket", flag.ExitOnError)
+	flags.BoolVar(&opts.Rehash, "rehash", true, "read every object and compare it against its hash")
+	flags.BoolVar(&opts.Refetch, "refetch", false, "download missing and corrupt images again")
+	flags.BoolVar(&opts.Delete, "delete", false, "delete orphans and whatever can't be repaired")
+	flags.Parse(args)
+
+	db, err := newDatabase()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	buck, err := newBucket()
+	if err != nil {
+		panic(err)
+	}
+
+	report, err := maintenance.New(db, buck, client.New()).Verify(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	printReport(report)
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func printReport(report any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+)
+
+func migrate(args []string) {
+	if standalone() {
+		panic(errors.New("the standalone store has no schema to migrate"))
+	}
+
+	db, err := database.New(databaseEnv())
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "up":
+		err = db.Migrate()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				panic(err)
+			}
+		}
+		err = db.Rollback(steps)
+	case "version":
+	default:
+		err = fmt.Errorf("unknown migrate command '%s', expected up, down or version", cmd)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	version, latest, err := db.Version()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("schema version %d, latest %d\n", version, latest)
+}
+
+// upgradeQueue redeclares the url queue of an older version the way this one
+// does, keeping its messages. The crawlers have to be stopped meanwhile.
+func upgradeQueue() {
+	if standalone() {
+		panic(errors.New("the standalone store has no queue to upgrade"))
+	}
+	n, err := queue.Upgrade(queueEnv(), envOrPanic("URL_QUEUE_NAME"), maxQueue)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("upgraded the queue, moved %d messages\n", n)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+	"github.com/kfc-manager/vision-seeker/crawler/service/data"
+)
+
+// startSeeds collects the seeds of START, SEEDS and SEED_FILE. START and
+// SEEDS hold urls separated by spaces or commas, SEED_FILE is read like the
+// input of "seed add -".
+func startSeeds() ([]*seed.Seed, error) {
+	urls := strings.FieldsFunc(
+		os.Getenv("START")+" "+os.Getenv("SEEDS"),
+		func(r rune) bool { return r == ' ' || r == ',' || r == '\n' },
+	)
+	seeds, err := seed.Parse(strings.NewReader(strings.Join(urls, "\n")))
+	if err != nil {
+		return nil, err
+	}
+
+	if file := os.Getenv("SEED_FILE"); len(file) > 0 {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fromFile, err := seed.Parse(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		seeds = append(seeds, fromFile...)
+	}
+	return seeds, nil
+}
+
+func addSeeds(dataServ data.Service, seeds []*seed.Seed, force bool) error {
+	for _, s := range seeds {
+		queued, err := dataServ.AddSeed(s, force)
+		if err != nil {
+			return err
+		}
+		if !queued {
+			slog.Warn("seed was visited before, add it with force to crawl it again", "url", s.Url)
+		}
+	}
+	return nil
+}
+
+func seedCmd(args []string) {
+	if len(args) < 1 {
+		panic(errors.New("expected seed add, list or remove"))
+	}
+
+	db, cach, que, err := newStores()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	defer que.Close()
+	// seeds never touch the bucket
+	dataServ := data.New(db, cach, nil, que, nil, slog.Default())
+
+	switch cmd := args[0]; cmd {
+	case "add":
+		seedAdd(dataServ, args[1:])
+	case "list":
+		seeds, err := dataServ.Seeds()
+		if err != nil {
+			panic(err)
+		}
+		printReport(seeds)
+	case "remove":
+		for _, url := range args[1:] {
+			removed, err := dataServ.RemoveSeed(url)
+			if err != nil {
+				panic(err)
+			}
+			if !removed {
+				slog.Warn("seed doesn't exist", "url", url)
+			}
+		}
+	default:
+		panic(fmt.Errorf("unknown seed command '%s', expected add, list or remove", cmd))
+	}
+}
+
+// seedAdd adds the urls in args, or the seeds read from stdin for "-".
+func seedAdd(dataServ data.Service, args []string) {
+	flags := flag.NewFlagSet("seed add", flag.ExitOnError)
+	force := flags.Bool("force", false, "queue seeds that were visited before")
+	budget := flags.Int("budget", 0, "pages queued from each seed, 0 is unlimited")
+	scopeFile := flags.String("scope", "", "json file with the scope of the seeds")
+	flags.Parse(args)
+
+	var sc *scope.Scope
+	if len(*scopeFile) > 0 {
+		b, err := os.ReadFile(*scopeFile)
+		if err != nil {
+			panic(err)
+		}
+		sc = &scope.Scope{}
+		if err := json.Unmarshal(b, sc); err != nil {
+			panic(err)
+		}
+	}
+
+	seeds := []*seed.Seed{}
+	for _, url := range flags.Args() {
+		if url != "-" {
+			seeds = append(seeds, &seed.Seed{Url: url, Scope: sc, Budget: *budget})
+			continue
+		}
+		parsed, err := seed.Parse(os.Stdin)
+		if err != nil {
+			panic(err)
+		}
+		seeds = append(seeds, parsed...)
+	}
+	if len(seeds) < 1 {
+		panic(errors.New("expected urls to add or - for stdin"))
+	}
+
+	if err := addSeeds(dataServ, seeds, *force); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
+	"github.com/kfc-manager/vision-seeker/crawler/service/health"
+)
+
+// startServer serves the metrics, /healthz and /readyz on METRICS_ADDR in the
+// background.
+func startServer(checks health.Service) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", checks.Healthz)
+	mux.HandleFunc("/readyz", checks.Readyz)
+
+	addr := envOrDefault("METRICS_ADDR", ":9090")
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("serving metrics and health failed", "addr", addr, "err", err)
+		}
+	}()
+}
+
+// probeKey is written and deleted again to tell the bucket is writable.
+const probeKey = "health/probe"
+
+func writable(buck bucket.Bucket) health.Check {
+	return func() error {
+		if err := buck.Put(probeKey, []byte{}); err != nil {
+			return err
+		}
+		return buck.Delete(probeKey)
+	}
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+)
+
+type Service interface {
+	Handler() http.Handler
+}
+
+type service struct {
+	catalog database.Catalog
+	bucket  bucket.Bucket
+	log     *slog.Logger
+}
+
+// New returns the API over the images in c, with their bytes read from b. A
+// nil logger logs to the default one.
+func New(c database.Catalog, b bucket.Bucket, log *slog.Logger) *service {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &service{catalog: c, bucket: b, log: log}
+}
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+func (s *service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /images", s.images)
+	mux.HandleFunc("GET /images/{hash}", s.image)
+	mux.HandleFunc("GET /images/{hash}/file", s.file)
+	mux.HandleFunc("GET /images/{hash}/labels", s.labels)
+	mux.HandleFunc("GET /search", s.search)
+	return mux
+}
+
+type imageView struct {
+	Hash       string    `json:"hash"`
+	Url        string    `json:"url"`
+	Format     string    `json:"format"`
+	Size       int       `json:"size"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Entropy    float64   `json:"entropy"`
+	ColorSpace string    `json:"color_space"`
+	BlurHash   string    `json:"blurhash,omitempty"`
+	ThumbHash  string    `json:"thumbhash,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func view(info *database.ImageInfo) *imageView {
+	return &imageView{
+		Hash:       info.Hash,
+		Url:        info.Url,
+		Format:     info.Format,
+		Size:       info.Size,
+		Width:      info.Width,
+		Height:     info.Height,
+		Entropy:    info.Entropy,
+		ColorSpace: info.ColorSpace,
+		BlurHash:   info.BlurHash,
+		ThumbHash:  info.ThumbHash,
+		CreatedAt:  info.CreatedAt,
+	}
+}
+
+func (s *service) image(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.find(w, r)
+	if !ok {
+		return
+	}
+	s.respond(w, http.StatusOK, view(info))
+}
+
+// file serves the image as it was stored. Its key is its hash, so it never
+// changes and clients may cache it for good.
+func (s *service) file(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.find(w, r)
+	if !ok {
+		return
+	}
+	body, err := s.bucket.Get(info.Hash + "." + info.Format)
+	if err == bucket.ErrNotFound {
+		s.fail(w, http.StatusNotFound, errors.New("image file missing"))
+		return
+	}
+	if err != nil {
+		s.internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/"+info.Format)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+info.Hash+`"`)
+	http.ServeContent(w, r, "", info.CreatedAt, bytes.NewReader(body))
+}
+
+func (s *service) labels(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.find(w, r)
+	if !ok {
+		return
+	}
+	labels, err := s.catalog.ImageLabels(info.Hash)
+	if err != nil {
+		s.internal(w, r, err)
+		return
+	}
+	s.respond(w, http.StatusOK, map[string][]string{"labels": labels})
+}
+
+// find answers 404 for a hash that isn't in the catalog and reports whether
+// it is.
+func (s *service) find(w http.ResponseWriter, r *http.Request) (*database.ImageInfo, bool) {
+	info, err := s.catalog.Image(r.PathValue("hash"))
+	if err != nil {
+		s.internal(w, r, err)
+		return nil, false
+	}
+	if info == nil {
+		s.fail(w, http.StatusNotFound, errors.New("image not found"))
+		return nil, false
+	}
+	return info, true
+}
+
+// images lists the images that pass the filters in the query, the latest
+// crawled first. The next page is asked for with the cursor of the last one.
+func (s *service) images(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	images, err := s.catalog.FindImages(f)
+	if err != nil {
+		s.internal(w, r, err)
+		return
+	}
+
+	res := struct {
+		Images []*imageView `json:"images"`
+		Next   string       `json:"next,omitempty"`
+	}{Images: make([]*imageView, 0, len(images))}
+	for _, info := range images {
+		res.Images = append(res.Images, view(info))
+	}
+	if len(images) == f.Limit {
+		last := images[len(images)-1]
+		res.Next = encodeCursor(&database.ImageCursor{CreatedAt: last.CreatedAt, Hash: last.Hash})
+	}
+	s.respond(w, http.StatusOK, res)
+}
+
+// search matches the labels against q, the way search engines take a query.
+func (s *service) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if len(query) < 1 {
+		s.fail(w, http.StatusBadRequest, errors.New("missing query 'q'"))
+		return
+	}
+	limit, err := parseLimit(q.Get("limit"))
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	offset := 0
+	if v := q.Get("offset"); len(v) > 0 {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			s.fail(w, http.StatusBadRequest, fmt.Errorf("invalid offset '%s'", v))
+			return
+		}
+	}
+
+	matches, err := s.catalog.SearchLabels(query, limit, offset)
+	if err != nil {
+		s.internal(w, r, err)
+		return
+	}
+	type result struct {
+		Image *imageView `json:"image"`
+		Label string     `json:"label"`
+		Rank  float64    `json:"rank"`
+	}
+	res := struct {
+		Results []*result `json:"results"`
+	}{Results: make([]*result, 0, len(matches))}
+	for _, m := range matches {
+		res.Results = append(res.Results, &result{Image: view(m.Image), Label: m.Label, Rank: m.Rank})
+	}
+	s.respond(w, http.StatusOK, res)
+}
+
+func parseLimit(v string) (int, error) {
+	if len(v) < 1 {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf("limit has to be between 1 and %d, got '%s'", maxLimit, v)
+	}
+	return limit, nil
+}
+
+// parseFilter reads the filter of /images from the query. Dates are RFC 3339
+// or just the day.
+func parseFilter(r *http.Request) (*database.ImageFilter, error) {
+	q := r.URL.Query()
+	f := &database.ImageFilter{Format: q.Get("format")}
+	var err error
+	if f.Limit, err = parseLimit(q.Get("limit")); err != nil {
+		return nil, err
+	}
+
+	ints := map[string]*int{
+		"min_width":  &f.MinWidth,
+		"max_width":  &f.MaxWidth,
+		"min_height": &f.MinHeight,
+		"max_height": &f.MaxHeight,
+	}
+	for name, dest := range ints {
+		if v := q.Get(name); len(v) > 0 {
+			if *dest, err = strconv.Atoi(v); err != nil || *dest < 0 {
+				return nil, fmt.Errorf("invalid %s '%s'", name, v)
+			}
+		}
+	}
+	floats := map[string]*float64{
+		"min_entropy": &f.MinEntropy,
+		"max_entropy": &f.MaxEntropy,
+	}
+	for name, dest := range floats {
+		if v := q.Get(name); len(v) > 0 {
+			if *dest, err = strconv.ParseFloat(v, 64); err != nil || *dest < 0 {
+				return nil, fmt.Errorf("invalid %s '%s'", name, v)
+			}
+		}
+	}
+	dates := map[string]*time.Time{
+		"since": &f.Since,
+		"until": &f.Until,
+	}
+	for name, dest := range dates {
+		if v := q.Get(name); len(v) > 0 {
+			if *dest, err = parseDate(v); err != nil {
+				return nil, fmt.Errorf("invalid %s '%s'", name, v)
+			}
+		}
+	}
+
+	if v := q.Get("cursor"); len(v) > 0 {
+		if f.After, err = decodeCursor(v); err != nil {
+			return nil, fmt.Errorf("invalid cursor '%s'", v)
+		}
+	}
+	return f, nil
+}
+
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// encodeCursor makes c opaque to clients, it is only ever handed back.
+func encodeCursor(c *database.ImageCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + c.Hash
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(v string) (*database.ImageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+	created, hash, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, errors.New("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil {
+		return nil, err
+	}
+	return &database.ImageCursor{CreatedAt: t, Hash: hash}, nil
+}
+
+func (s *service) respond(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.log.Debug("writing response failed", "err", err)
+	}
+}
+
+func (s *service) fail(w http.ResponseWriter, status int, err error) {
+	s.respond(w, status, map[string]string{"error": err.Error()})
+}
+
+// internal hides what went wrong on our side from the client, it is logged
+// instead.
+func (s *service) internal(w http.ResponseWriter, r *http.Request, err error) {
+	s.log.Error("request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+	s.fail(w, http.StatusInternalServerError, errors.New("internal error"))
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	gourl "net/url"
+	"os"
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/memory"
+	"github.com/kfc-manager/vision-seeker/crawler/domain"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+	"github.com/kfc-manager/vision-seeker/crawler/service/data"
+)
+
+func get(t *testing.T, h http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestAPI(t *testing.T) {
+	db := memory.NewDatabase()
+	buck := bucket.NewSharded(memory.NewBucket())
+	d := data.New(db, memory.NewCache(), buck, memory.NewQueue(0), nil, nil)
+	hashes := []string{}
+	for _, f := range []struct{ file, label string }{
+		{"non-trans.png", "a red fox in the snow"},
+		{"non-trans.jpeg", "a red car"},
+		{"trans.png", "logo"},
+	} {
+		b, err := os.ReadFile("../../test/" + f.file)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		img, err := image.Load(b)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		url, _ := gourl.Parse("https://example.com/" + f.file)
+		if _, err := d.StoreImage(context.Background(), img, url, f.label); err != nil {
+			t.Fatal(err.Error())
+		}
+		hash, _ := domain.Sha256(img.Data)
+		hashes = append(hashes, hash)
+	}
+	h := New(db, buck, nil).Handler()
+
+	w := get(t, h, "/images/"+hashes[0], nil)
+	img := &imageView{}
+	decode(t, w, img)
+	if w.Code != http.StatusOK || img.Hash != hashes[0] || img.Format != "png" ||
+		img.Url != "https://example.com/non-trans.png" || img.Width < 1 || img.CreatedAt.IsZero() {
+		t.Errorf("unexpected image: %d %+v", w.Code, img)
+	}
+	if w := get(t, h, "/images/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("got status: %d, for a missing image, want: 404", w.Code)
+	}
+
+	w = get(t, h, "/images/"+hashes[0]+"/file", nil)
+	want, _ := os.ReadFile("../../test/non-trans.png")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" ||
+		!bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("unexpected file: %d %s", w.Code, w.Header())
+	}
+	w = get(t, h, "/images/"+hashes[0]+"/file", http.Header{"If-None-Match": {`"` + hashes[0] + `"`}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("got status: %d, for a cached file, want: 304", w.Code)
+	}
+
+	w = get(t, h, "/images/"+hashes[1]+"/labels", nil)
+	labels := map[string][]string{}
+	decode(t, w, &labels)
+	if len(labels["labels"]) != 1 || labels["labels"][0] != "a red car" {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+
+	w = get(t, h, "/search?q=red+fox", nil)
+	search := struct {
+		Results []struct {
+			Image *imageView
+			Label string
+		}
+	}{}
+	decode(t, w, &search)
+	if len(search.Results) != 1 || search.Results[0].Image.Hash != hashes[0] {
+		t.Errorf("unexpected search results: %+v", search)
+	}
+	if w := get(t, h, "/search", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("got status: %d, for a search without query, want: 400", w.Code)
+	}
+
+	// page through the pngs, the latest first
+	found := []string{}
+	next := ""
+	for i := 0; i < 3; i++ {
+		w := get(t, h, "/images?format=png&limit=1&cursor="+next, nil)
+		page := struct {
+			Images []*imageView
+			Next   string
+		}{}
+		decode(t, w, &page)
+		for _, img := range page.Images {
+			found = append(found, img.Hash)
+		}
+		if next = page.Next; len(next) < 1 {
+			break
+		}
+	}
+	if len(found) != 2 || found[0] != hashes[2] || found[1] != hashes[0] {
+		t.Errorf("got images: %v, want: %v", found, []string{hashes[2], hashes[0]})
+	}
+	for _, query := range []string{"limit=0", "min_width=wide", "since=yesterday", "cursor=notacursor"} {
+		if w := get(t, h, "/images?"+query, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("got status: %d, for query: %s, want: 400", w.Code, query)
+		}
+	}
+}
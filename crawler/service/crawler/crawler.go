@@ -1,88 +1,348 @@
 package crawler
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	gourl "net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/client"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/tracing"
 	"github.com/kfc-manager/vision-seeker/crawler/domain/html"
 	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
 	"github.com/kfc-manager/vision-seeker/crawler/service/data"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Service interface {
 	Crawl()
+	// Progress fails once the crawl loop stopped or spent longer than
+	// threshold on a single task.
+	Progress(threshold time.Duration) error
 }
 
 type service struct {
 	client client.Client
 	data   data.Service
+	srgb   bool
+	log    *slog.Logger
+
+	mu      sync.Mutex
+	task    *data.Task // in work, nil while waiting for one
+	started time.Time
+	stopped bool
 }
 
-func New(c client.Client, d data.Service) *service {
-	return &service{client: c, data: d}
+// New returns the crawler. A nil logger logs to the default one.
+func New(c client.Client, d data.Service, srgb bool, log *slog.Logger) *service {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &service{client: c, data: d, srgb: srgb, log: log}
 }
 
-func (s *service) Crawl() {
-	url, alt, err := s.data.Next()
-	if err != nil {
-		return
+// maxVisits bounds how many links of a page are visited at the same time.
+// Visiting them concurrently lets the database batch their inserts.
+const maxVisits = 64
+
+type visit struct {
+	url   *gourl.URL
+	text  string // alt of images, anchor of links
+	width int
+	image bool
+}
+
+// visitAll returns the first error of a visit, the links of the page have to
+// be visited again then.
+func (s *service) visitAll(from *data.Task, visits []*visit) error {
+	sem := make(chan struct{}, maxVisits)
+	wg := &sync.WaitGroup{}
+	mu := sync.Mutex{}
+	var first error
+	for _, v := range visits {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(v *visit) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var err error
+			if v.image {
+				err = s.data.VisitImage(from, v.url, v.text, v.width)
+			} else {
+				err = s.data.Visit(from, v.url, v.text)
+			}
+			if err != nil {
+				s.log.Warn("visit failed",
+					"url", v.url.String(), "from", from.Url.String(), "image", v.image, "err", err)
+				mu.Lock()
+				if first == nil {
+					first = err
+				}
+				mu.Unlock()
+			}
+		}(v)
 	}
-	defer s.Crawl()
+	wg.Wait()
+	return first
+}
 
-	res, err := s.client.Get(url.String())
+// resolve returns ref relative to the page at base without its fragment, or
+// nil if it isn't a valid reference.
+func resolve(base *gourl.URL, ref string) *gourl.URL {
+	if len(ref) < 1 {
+		return nil
+	}
+	u, err := gourl.Parse(ref)
 	if err != nil {
-		return
+		return nil
 	}
+	u = base.ResolveReference(u)
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u
+}
 
-	if res.Type == client.Image {
-		img, err := image.Load(res.Body)
-		if err != nil {
-			return
-		}
-		if !img.Valid(300, 300, 3.0, false) {
-			return
+// imageVisits visits the src of img and the widest candidate of its srcset,
+// which is often larger than the src.
+func imageVisits(base *gourl.URL, img *html.Node) []*visit {
+	alt := img.Attribute("alt")
+	visits := []*visit{}
+	if src := resolve(base, img.Attribute("src")); src != nil {
+		width, _ := strconv.Atoi(img.Attribute("width"))
+		visits = append(visits, &visit{url: src, text: alt, width: width, image: true})
+	}
+
+	var widest *html.Source
+	for _, src := range img.Srcset() {
+		if widest == nil || src.Width > widest.Width {
+			widest = src
 		}
-		_ = s.data.StoreImage(img, alt)
 	}
+	if widest == nil {
+		return visits
+	}
+	if src := resolve(base, widest.Url); src != nil {
+		visits = append(visits, &visit{url: src, text: alt, width: widest.Width, image: true})
+	}
+	return visits
+}
 
-	if res.Type == client.Html {
-		doc, err := html.Parse(res.Body)
+// Crawl processes tasks until the queue is closed. A task is only acked once
+// it was processed, a failure of our own, like the database being down, gives
+// it back to the queue. A page that can't be fetched or parsed is done with.
+func (s *service) Crawl() {
+	defer func() {
+		s.mu.Lock()
+		s.stopped = true
+		s.mu.Unlock()
+	}()
+	for {
+		s.working(nil)
+		task, err := s.data.Next()
 		if err != nil {
+			s.log.Error("no more tasks", "err", err)
 			return
 		}
 
-		for _, img := range doc.Images() {
-			src := img.Attribute("src")
-			if len(src) < 1 {
-				continue
-			}
-			imgUrl, err := gourl.Parse(src)
-			if err != nil {
-				continue
-			}
-			if len(imgUrl.Scheme) < 1 {
-				imgUrl.Scheme = url.Scheme
-			}
-			if len(imgUrl.Host) < 1 {
-				imgUrl.Host = url.Host
+		start := s.working(task)
+		res := &result{}
+		span := task.Trace("crawl")
+		err = s.crawl(task, res)
+		span.SetAttributes(
+			attribute.String("url.full", task.Url.String()),
+			attribute.String("outcome", res.outcome),
+		)
+		metrics.Tasks.WithLabelValues(res.outcome).Inc()
+		log := s.log.With(
+			"url", task.Url.String(),
+			"host", task.Url.Hostname(),
+			"status", res.status,
+			"outcome", res.outcome,
+			"duration", time.Since(start),
+		)
+		if res.err != nil {
+			log = log.With("reason", res.err)
+		}
+		if err != nil {
+			log.Error("crawl failed, giving the task back", "err", err)
+			if err := task.Nack(true); err != nil {
+				log.Error("nack failed", "err", err)
 			}
-			_ = s.data.Visit(imgUrl, img.Attribute("alt"))
+			tracing.End(span, err)
+			continue
+		}
+		log.Info("crawled", "links", res.links)
+		if err := task.Ack(); err != nil {
+			log.Error("ack failed", "err", err)
 		}
+		span.End()
+	}
+}
 
-		for _, l := range doc.Links() {
-			link, err := gourl.Parse(l)
-			if err != nil {
-				continue
-			}
-			if len(link.Scheme) < 1 {
-				link.Scheme = url.Scheme
+// working notes the task in work and returns when it was started.
+func (s *service) working(task *data.Task) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.task, s.started = task, time.Now()
+	return s.started
+}
+
+// Progress counts waiting for a task as progress, an empty queue is no
+// reason to restart.
+func (s *service) Progress(threshold time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return errors.New("crawl loop stopped")
+	}
+	if s.task != nil && time.Since(s.started) > threshold {
+		return fmt.Errorf("stuck on %s for %s", s.task.Url.String(), time.Since(s.started).Round(time.Second))
+	}
+	return nil
+}
+
+// result is what came of a task, for the log.
+type result struct {
+	status  int
+	outcome string
+	err     error // why a page or image was given up on
+	links   int
+}
+
+const (
+	outcomeFetchFailed  = "fetch_failed"
+	outcomeNotModified  = "not_modified"
+	outcomeInvalid      = "invalid_image"
+	outcomeStored       = "image_stored"
+	outcomeUnchanged    = "unchanged"
+	outcomeParseFailed  = "parse_failed"
+	outcomeParsed       = "parsed"
+	outcomeUnknownType  = "unknown_type"
+	outcomeInfraFailure = "failed"
+)
+
+// done records what came of a url that needs no retry. It returns nil, so
+// the task is acked.
+func (r *result) done(outcome string, err error) error {
+	r.outcome, r.err = outcome, err
+	return nil
+}
+
+func (s *service) crawl(task *data.Task, r *result) error {
+	url, alt, ctx := task.Url, task.Alt, task.Context()
+	r.outcome = outcomeInfraFailure
+
+	res, err := s.client.GetIfChanged(ctx, url.String(), task.ETag, task.LastModified)
+	if err != nil {
+		var status *client.StatusError
+		if errors.As(err, &status) {
+			// the status says it, without the body of the error page
+			r.status, err = status.Status, nil
+		}
+		if err := s.data.FetchFailed(task); err != nil {
+			return err
+		}
+		return r.done(outcomeFetchFailed, err)
+	}
+	r.status = res.Status
+	if res.NotModified {
+		if _, err := s.data.RecordFetch(task, res.ETag, res.LastModified, nil); err != nil {
+			return err
+		}
+		return r.done(outcomeNotModified, nil)
+	}
+
+	if res.Type == client.Image {
+		img, err := tracing.Do(ctx, "image.load", func() (*image.Image, error) {
+			return image.Load(res.Body)
+		})
+		if err != nil {
+			metrics.ImagesRejected.WithLabelValues("decode").Inc()
+			return r.done(outcomeInvalid, err)
+		}
+		if s.srgb {
+			if err := tracing.Run(ctx, "image.to_srgb", img.ToSRGB); err != nil {
+				metrics.ImagesRejected.WithLabelValues("color_space").Inc()
+				return r.done(outcomeInvalid, err)
 			}
-			if len(link.Host) < 1 {
-				link.Host = url.Host
+		}
+		reason, _ := tracing.Do(ctx, "image.valid", func() (image.Rejection, error) {
+			return img.Reject(300, 300, 3.0, false), nil
+		})
+		if len(reason) > 0 {
+			metrics.ImagesRejected.WithLabelValues(string(reason)).Inc()
+			return r.done(outcomeInvalid, nil)
+		}
+		stored, err := s.data.StoreImage(ctx, img, url, alt)
+		if err != nil {
+			return err
+		}
+		if stored {
+			if err := s.data.Accepted(task); err != nil {
+				return err
 			}
-			_ = s.data.Visit(link, "")
 		}
+		metrics.ImagesAccepted.Inc()
+		return r.done(outcomeStored, nil)
 	}
 
-	s.Crawl()
+	if res.Type == client.Html {
+		metrics.PagesFetched.Inc()
+		if err := s.page(task, res.Body, r); err != nil {
+			return err
+		}
+		// only now that the links are queued, a retry has to find the page
+		// changed to queue them
+		if _, err := s.data.RecordFetch(task, res.ETag, res.LastModified, res.Body); err != nil {
+			r.outcome = outcomeInfraFailure
+			return err
+		}
+		return nil
+	}
+
+	return r.done(outcomeUnknownType, nil)
+}
+
+// page visits the links and images of the html page of task, unless they are
+// the same as last time.
+func (s *service) page(task *data.Task, body []byte, r *result) error {
+	changed, err := s.data.Changed(task, body)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return r.done(outcomeUnchanged, nil)
+	}
+
+	doc, err := tracing.Do(task.Context(), "html.parse", func() (*html.Node, error) {
+		return html.Parse(body)
+	})
+	if err != nil {
+		return r.done(outcomeParseFailed, err)
+	}
+
+	visits := []*visit{}
+	for _, img := range doc.Images() {
+		visits = append(visits, imageVisits(task.Url, img)...)
+	}
+
+	for _, l := range doc.Links() {
+		link := resolve(task.Url, l.Href)
+		if link == nil {
+			continue
+		}
+		visits = append(visits, &visit{url: link, text: l.Text})
+	}
+
+	r.links = len(visits)
+	if err := s.visitAll(task, visits); err != nil {
+		return err
+	}
+	return r.done(outcomeParsed, nil)
 }
@@ -0,0 +1,314 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	goimage "image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	gourl "net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/client"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/memory"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
+	"github.com/kfc-manager/vision-seeker/crawler/service/data"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func noise(t *testing.T, width, height int) []byte {
+	r := rand.New(rand.NewSource(1))
+	src := goimage.NewRGBA(goimage.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			src.Set(x, y, color.RGBA{uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256)), 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err.Error())
+	}
+	return buf.Bytes()
+}
+
+func TestCrawl(t *testing.T) {
+	big := noise(t, 320, 320)
+	small, err := os.ReadFile("../../test/non-trans.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	done := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>
+			<img src="/big.png" alt="noise">
+			<a href="/other">other</a>
+			<a href="/">self</a>
+		</body></html>`))
+	})
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><img src="/small.png" alt="tiny"></body></html>`))
+	})
+	mux.HandleFunc("/big.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(big)
+	})
+	mux.HandleFunc("/small.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(small)
+		close(done)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	db := memory.NewDatabase()
+	que := memory.NewQueue(0)
+	d := data.New(db, memory.NewCache(), memory.NewBucket(), que, nil, nil)
+	start, _ := gourl.Parse(srv.URL + "/")
+	if err := d.Visit(nil, start, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	accepted := testutil.ToFloat64(metrics.ImagesAccepted)
+	rejected := testutil.ToFloat64(metrics.ImagesRejected.WithLabelValues("too_small"))
+	logs := &bytes.Buffer{}
+	log := slog.New(slog.NewTextHandler(logs, nil))
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	serv := New(client.New(), d, false, log)
+	crawled := make(chan struct{})
+	go func() {
+		serv.Crawl()
+		close(crawled)
+	}()
+
+	// the small image is the last thing reachable, closing the queue stops
+	// the crawler once it is done with it
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawler didn't reach every page")
+	}
+	que.Close()
+	select {
+	case <-crawled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawler didn't stop after the queue was closed")
+	}
+	if err := serv.Progress(time.Minute); err == nil {
+		t.Error("stopped crawler reports progress")
+	}
+
+	images := []*database.ImageRecord{}
+	err = db.Images(func(rec *database.ImageRecord) error {
+		images = append(images, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(images) != 1 || images[0].Url != srv.URL+"/big.png" || !images[0].Labeled {
+		t.Errorf("unexpected images: %+v", images)
+	}
+
+	if got := testutil.ToFloat64(metrics.ImagesAccepted) - accepted; got != 1 {
+		t.Errorf("got accepted images: %f, want: 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.ImagesRejected.WithLabelValues("too_small")) - rejected; got != 1 {
+		t.Errorf("got rejected images: %f, want: 1", got)
+	}
+
+	// every url is logged with what came of it
+	for _, want := range []string{
+		"url=" + srv.URL + "/big.png host=127.0.0.1 status=200 outcome=image_stored",
+		"url=" + srv.URL + "/small.png host=127.0.0.1 status=200 outcome=invalid_image",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("missing log line with: %s, got:\n%s", want, logs.String())
+		}
+	}
+
+	// an image is traced with the page it was found on, a page gets a trace
+	// of its own linked to it
+	crawls := map[string]sdktrace.ReadOnlySpan{}
+	names := map[string]bool{}
+	for _, span := range spans.Ended() {
+		names[span.Name()] = true
+		if span.Name() != "crawl" {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Key == "url.full" {
+				crawls[strings.TrimPrefix(attr.Value.AsString(), srv.URL)] = span
+			}
+		}
+	}
+	root, img, other := crawls["/"], crawls["/big.png"], crawls["/other"]
+	if root == nil || img == nil || other == nil {
+		t.Fatalf("missing crawl spans, got: %v", crawls)
+	}
+	if img.Parent().SpanID() != root.SpanContext().SpanID() ||
+		img.SpanContext().TraceID() != root.SpanContext().TraceID() {
+		t.Error("image isn't traced with the page it was found on")
+	}
+	if other.SpanContext().TraceID() == root.SpanContext().TraceID() ||
+		len(other.Links()) != 1 ||
+		other.Links()[0].SpanContext.SpanID() != root.SpanContext().SpanID() {
+		t.Error("page isn't traced on its own, linked to the page it was found on")
+	}
+	for _, name := range []string{
+		"client.get", "html.parse", "image.load", "image.valid",
+		"database.insert_url", "queue.push", "bucket.put", "queue.ack",
+	} {
+		if !names[name] {
+			t.Errorf("missing span: %s", name)
+		}
+	}
+}
+
+func TestRecrawl(t *testing.T) {
+	conditional := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			close(conditional)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body></body></html>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	db := memory.NewDatabase()
+	que := memory.NewQueue(0)
+	d := data.New(db, memory.NewCache(), memory.NewBucket(), que, nil, nil)
+	start, _ := gourl.Parse(srv.URL + "/")
+	if err := d.Visit(nil, start, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	crawled := make(chan struct{})
+	go func() {
+		New(client.New(), d, false, nil).Crawl()
+		close(crawled)
+	}()
+
+	// make the page due as soon as the first fetch was recorded
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		pages, err := db.ClaimPages(time.Now().Add(48*time.Hour), 0, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(pages) > 0 {
+			pages[0].NextFetch = time.Now()
+			if err := db.SavePage(pages[0]); err != nil {
+				t.Fatal(err.Error())
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first fetch was never recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n, err := d.Revisit(time.Hour, 10); err != nil || n != 1 {
+		t.Fatalf("got %d revisits: %v", n, err)
+	}
+
+	select {
+	case <-conditional:
+	case <-time.After(10 * time.Second):
+		t.Fatal("revisit wasn't a conditional request")
+	}
+	que.Close()
+	<-crawled
+
+	pages, err := db.ClaimPages(time.Now().Add(48*time.Hour), 0, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pages) != 1 || pages[0].Fetches != 2 || pages[0].Changes != 1 {
+		t.Errorf("unexpected pages: %+v", pages)
+	}
+}
+
+// failingVisit fails the first visit of a link found on a page.
+type failingVisit struct {
+	data.Service
+	failed atomic.Bool
+}
+
+func (d *failingVisit) Visit(from *data.Task, url *gourl.URL, anchor string) error {
+	if from != nil && d.failed.CompareAndSwap(false, true) {
+		return errors.New("queue down")
+	}
+	return d.Service.Visit(from, url, anchor)
+}
+
+func TestVisitFailed(t *testing.T) {
+	fetches := atomic.Int32{}
+	refetched := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) == 2 {
+			close(refetched)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><a href="/other">other</a></body></html>`))
+	})
+	reached := make(chan struct{})
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body></body></html>`))
+		close(reached)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	que := memory.NewQueue(0)
+	d := &failingVisit{Service: data.New(memory.NewDatabase(), memory.NewCache(), memory.NewBucket(), que, nil, nil)}
+	start, _ := gourl.Parse(srv.URL + "/")
+	if err := d.Visit(nil, start, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	crawled := make(chan struct{})
+	go func() {
+		New(client.New(), d, false, nil).Crawl()
+		close(crawled)
+	}()
+
+	// the page whose links couldn't be queued is given back and fetched
+	// again, the retry queues them
+	select {
+	case <-refetched:
+	case <-time.After(10 * time.Second):
+		t.Fatal("page wasn't fetched again after a visit failed")
+	}
+	select {
+	case <-reached:
+	case <-time.After(10 * time.Second):
+		t.Fatal("retry didn't queue the links of the page")
+	}
+	que.Close()
+	<-crawled
+}
@@ -1,21 +1,68 @@
 package data
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	gourl "net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/cache"
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/metrics"
 	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/tracing"
 	"github.com/kfc-manager/vision-seeker/crawler/domain"
 	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/priority"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Service interface {
-	StoreImage(img *image.Image, label string) error
-	Visit(url *gourl.URL, alt string) error
-	Next() (*gourl.URL, string, error)
+	// StoreImage reports whether the image wasn't stored before.
+	StoreImage(ctx context.Context, img *image.Image, url *gourl.URL, label string) (bool, error)
+	Recover() error
+	Visit(from *Task, url *gourl.URL, anchor string) error
+	VisitImage(from *Task, url *gourl.URL, alt string, width int) error
+	Accepted(task *Task) error
+	Next() (*Task, error)
+	Changed(task *Task, body []byte) (bool, error)
+	RecordFetch(task *Task, etag, lastModified string, body []byte) (bool, error)
+	FetchFailed(task *Task) error
+	Revisit(lease time.Duration, limit int) (int, error)
+	AddSeed(sd *seed.Seed, force bool) (bool, error)
+	RemoveSeed(url string) (bool, error)
+	Seeds() ([]*seed.Seed, error)
+}
+
+// Task is a url taken from the queue with the seed and the page it was found
+// from and how many links away from the seed. Revisits carry the validators
+// of the last fetch for a conditional request. A task taken from the queue
+// has to be acked or nacked.
+//
+// An image is traced as part of the page it was found on, a page starts a
+// trace of its own linked to the one it was found on. A single trace per
+// seed would grow with the crawl.
+type Task struct {
+	Url          *gourl.URL
+	Alt          string
+	Seed         *gourl.URL
+	From         *gourl.URL // nil for seeds and revisits
+	Depth        int
+	ETag         string
+	LastModified string
+
+	delivery queue.Delivery
+	parent   trace.SpanContext
+	link     trace.SpanContext
+	ctx      context.Context
 }
 
 type service struct {
@@ -23,104 +70,781 @@ type service struct {
 	cache  cache.Cache
 	bucket bucket.Bucket
 	queue  queue.Queue
+	scopes *scope.Config
+	log    *slog.Logger
+
+	seeds  *ttlCache[*seed.Seed]
+	yields *ttlCache[int]
+
+	// spilled is set while messages may be waiting in the overflow, drain
+	// holds mu throughout so it can't miss one spilled meanwhile
+	mu      sync.Mutex
+	spilled bool
 }
 
+// cacheTTL is how long seeds and host yields are remembered, so a seed
+// removed or changed by another process takes effect here after at most that
+// long.
+const cacheTTL = time.Minute
+
+// New returns the data service. A nil scope config lets every link in, a nil
+// logger logs to the default one.
 func New(
 	db database.Database,
 	c cache.Cache,
 	b bucket.Bucket,
 	q queue.Queue,
+	scopes *scope.Config,
+	log *slog.Logger,
 ) *service {
+	if log == nil {
+		log = slog.Default()
+	}
 	return &service{
 		db:     db,
 		cache:  c,
 		bucket: b,
 		queue:  q,
+		scopes: scopes,
+		log:    log,
+		seeds:  newTTLCache[*seed.Seed](cacheTTL),
+		yields: newTTLCache[int](cacheTTL),
+		// whatever the last run left in the overflow
+		spilled: true,
 	}
 }
 
-func (s *service) StoreImage(img *image.Image, label string) error {
+// stagingPrefix is the outbox of StoreImage. Objects are written there
+// before the database transaction and only moved to their real key after it
+// committed, so a crash at any point leaves something Recover can settle.
+const stagingPrefix = "staging/"
+
+func (s *service) StoreImage(
+	ctx context.Context,
+	img *image.Image,
+	url *gourl.URL,
+	label string,
+) (bool, error) {
 	imgHash, err := domain.Sha256(img.Data)
 	if err != nil {
-		return err
+		return false, err
 	}
-	ok, err := s.db.InsertImage(imgHash, img)
+	lblHash, err := domain.Sha256([]byte(label))
 	if err != nil {
-		return err
+		return false, err
 	}
-	if ok {
-		err := s.bucket.Put(imgHash, img.Data)
-		if err != nil {
-			return err
+	key := imgHash + "." + img.Format
+	// walks the pixels, which has no business holding a connection
+	info := database.NewImageInfo(imgHash, url.String(), img)
+
+	err = tracing.Run(ctx, "bucket.put", func() error {
+		return s.bucket.Put(stagingPrefix+key, img.Data)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := tracing.Do(ctx, "database.insert_image", func() (bool, error) {
+		return s.insertImage(info, lblHash, label)
+	})
+	if err != nil {
+		derr := tracing.Run(ctx, "bucket.delete", func() error {
+			return s.bucket.Delete(stagingPrefix + key)
+		})
+		if derr != nil {
+			// Recover deletes it later
+			s.log.Warn("staged image left behind", "key", stagingPrefix+key, "err", derr)
 		}
+		return false, err
 	}
 
-	lblHash, err := domain.Sha256([]byte(label))
+	err = tracing.Run(ctx, "bucket.publish", func() error {
+		return s.publish(key, img.Data)
+	})
+	return inserted, err
+}
+
+// insertImage reports whether the image wasn't in the database before.
+func (s *service) insertImage(info *database.ImageInfo, lblHash, label string) (bool, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return false, err
 	}
-	_, err = s.db.InsertLabel(lblHash, label)
+	defer tx.Rollback()
+
+	inserted, err := tx.InsertImage(info)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.InsertLabel(lblHash, label); err != nil {
+		return false, err
+	}
+	if _, err := tx.InsertMapping(info.Hash, lblHash); err != nil {
+		return false, err
+	}
+
+	return inserted, tx.Commit()
+}
+
+// publish makes sure the object exists under its real key and clears the
+// staged copy. An image that was already known still gets written if its
+// object went missing.
+func (s *service) publish(key string, body []byte) error {
+	exist, err := s.bucket.Exists(key)
 	if err != nil {
 		return err
 	}
+	if !exist {
+		if err := s.bucket.Put(key, body); err != nil {
+			return err
+		}
+	}
+	return s.bucket.Delete(stagingPrefix + key)
+}
 
-	_, err = s.db.InsertMapping(imgHash, lblHash)
+// Recover settles objects left in staging by a previous run. Whatever made it
+// into the database gets published, everything else is dropped.
+func (s *service) Recover() error {
+	staged := []string{}
+	err := s.bucket.List(stagingPrefix, func(key string) error {
+		staged = append(staged, strings.TrimPrefix(key, stagingPrefix))
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
+	for _, key := range staged {
+		exist, err := s.db.ExistImage(bucket.FlatKey(key))
+		if err != nil {
+			return err
+		}
+		if !exist {
+			if err := s.bucket.Delete(stagingPrefix + key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		body, err := s.bucket.Get(stagingPrefix + key)
+		if err == bucket.ErrNotFound {
+			// published concurrently
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.publish(key, body); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 type message struct {
-	Url string `json:"url"`
-	Alt string `json:"alt"`
+	Url          string `json:"url"`
+	Alt          string `json:"alt"`
+	Seed         string `json:"seed,omitempty"`
+	From         string `json:"from,omitempty"`
+	Depth        int    `json:"depth,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
 }
 
-func (s *service) Visit(url *gourl.URL, alt string) error {
-	hash, err := domain.Sha256([]byte(url.Host + url.Path + url.RawQuery))
-	if err != nil {
+// linkHeader marks a message whose traceparent header is the span to link
+// to rather than to continue, see Task.
+const linkHeader = "x-trace-link"
+
+// traceHeaders carries the span of ctx along a message in the W3C
+// traceparent header, nil if there is none.
+func traceHeaders(ctx context.Context, isPage bool) map[string]string {
+	headers := tracing.Inject(ctx)
+	if headers != nil && isPage {
+		headers[linkHeader] = "true"
+	}
+	return headers
+}
+
+func urlHash(url *gourl.URL) (string, error) {
+	return domain.Sha256([]byte(url.Host + url.Path + url.RawQuery))
+}
+
+// Visit queues the page at url if it is new and in the scope of the seed
+// from was found from, ranked by the text of its anchor. Without from, url is
+// a seed itself and goes first.
+func (s *service) Visit(from *Task, url *gourl.URL, anchor string) error {
+	msg := &message{Url: url.String(), Seed: url.String()}
+	if from == nil {
+		_, err := s.visit(context.Background(), url, msg, priority.Max, true, false)
 		return err
 	}
-	exist, err := s.cache.Exist(hash)
+
+	ctx := from.Context()
+	msg.Seed = from.Seed.String()
+	msg.From = from.Url.String()
+	msg.Depth = from.Depth + 1
+	sc, err := s.scope(ctx, msg.Seed)
 	if err != nil {
 		return err
 	}
-	if exist {
+	if sc == nil || !sc.Link(from.Seed, url, msg.Depth) {
 		return nil
 	}
+	yield, err := s.yield(ctx, url.Hostname())
+	if err != nil {
+		return err
+	}
+	prio := priority.Score(&priority.Signals{
+		Depth:     msg.Depth,
+		HostYield: yield,
+		Anchor:    anchor,
+	})
+	_, err = s.visit(ctx, url, msg, prio, true, false)
+	return err
+}
 
-	ok, err := s.db.InsertUrl(hash)
+// VisitImage queues the image at url if it is new and not excluded by the
+// scope of the seed from was found from, ranked by the width it was declared
+// with, 0 if unknown.
+func (s *service) VisitImage(from *Task, url *gourl.URL, alt string, width int) error {
+	ctx := from.Context()
+	msg := &message{
+		Url:   url.String(),
+		Alt:   alt,
+		Seed:  from.Seed.String(),
+		From:  from.Url.String(),
+		Depth: from.Depth + 1,
+	}
+	sc, err := s.scope(ctx, msg.Seed)
 	if err != nil {
 		return err
 	}
-	if !ok {
+	if sc == nil || !sc.Image(url) {
 		return nil
 	}
-
-	b, err := json.Marshal(&message{Url: url.String(), Alt: alt})
+	yield, err := s.yield(ctx, from.Url.Hostname())
 	if err != nil {
 		return err
 	}
+	prio := priority.Score(&priority.Signals{
+		Image:     true,
+		HostYield: yield,
+		Width:     width,
+	})
+	queued, err := s.visit(ctx, url, msg, prio, false, false)
+	if queued && err == nil {
+		metrics.ImagesDiscovered.Inc()
+	}
+	return err
+}
 
-	return s.queue.Push(b)
+// Accepted credits the host of the page the image of task was found on, its
+// links and images are ranked higher from then on. Only an image StoreImage
+// found new is to be credited, a redelivered one would count twice.
+func (s *service) Accepted(task *Task) error {
+	if task.From == nil {
+		return nil
+	}
+	_, err := tracing.Do(task.Context(), "database.incr_host_images", func() (int, error) {
+		return s.db.IncrHostImages(task.From.Hostname())
+	})
+	return err
 }
 
-func (s *service) Next() (*gourl.URL, string, error) {
-	b, err := s.queue.Pull()
+// yield returns how many images were accepted from pages on host.
+func (s *service) yield(ctx context.Context, host string) (int, error) {
+	return s.yields.get(host, func() (int, error) {
+		return tracing.Do(ctx, "database.host_images", func() (int, error) {
+			return s.db.HostImages(host)
+		})
+	})
+}
+
+// visit queues msg if url is new and reports whether it did. Force queues it
+// regardless, past the cache and the page limits.
+func (s *service) visit(
+	ctx context.Context,
+	url *gourl.URL,
+	msg *message,
+	prio uint8,
+	isPage, force bool,
+) (bool, error) {
+	hash, err := urlHash(url)
 	if err != nil {
-		return nil, "", err
+		return false, err
 	}
+	if !force {
+		// the database decides below anyway, an unreachable cache only
+		// costs the shortcut
+		exist, err := tracing.Do(ctx, "cache.exist", func() (bool, error) {
+			return s.cache.Exist(hash)
+		})
+		if err != nil {
+			s.log.Debug("cache lookup failed", "url", url.String(), "err", err)
+		}
+		if err == nil && exist {
+			return false, nil
+		}
+	}
+
+	inserted, err := tracing.Do(ctx, "database.insert_url", func() (bool, error) {
+		return s.db.InsertUrl(hash)
+	})
+	if err != nil {
+		return false, err
+	}
+	if !inserted && !force {
+		s.remember(ctx, url, hash)
+		return false, nil
+	}
+
+	queued, b := true, &booking{}
+	if isPage && !force {
+		queued, err = s.count(ctx, url, msg.Seed, b)
+	}
+	if err == nil && queued {
+		err = s.push(ctx, msg, prio, traceHeaders(ctx, isPage))
+	}
+	if err != nil {
+		// the url isn't visited until it made it into the queue, so it is
+		// found again when the page it was found on is retried
+		if inserted {
+			s.unvisit(ctx, url, hash, b)
+		}
+		return false, err
+	}
+	s.remember(ctx, url, hash)
+	return queued, nil
+}
+
+// remember writes the visited url through to the cache, so the next time it
+// is found the cache answers instead of the database. Failing to only costs
+// that round trip.
+func (s *service) remember(ctx context.Context, url *gourl.URL, hash string) {
+	err := tracing.Run(ctx, "cache.set", func() error { return s.cache.Set(hash) })
+	if err != nil {
+		s.log.Debug("cache write failed", "url", url.String(), "err", err)
+	}
+}
+
+// unvisit takes back the insert of a url that couldn't be queued and what it
+// was booked against, so retrying it doesn't use up the limits.
+func (s *service) unvisit(ctx context.Context, url *gourl.URL, hash string, b *booking) {
+	err := tracing.Run(ctx, "database.delete_url", func() error { return s.db.DeleteUrl(hash) })
+	if err != nil {
+		s.log.Error("url stays visited without being queued", "url", url.String(), "err", err)
+	}
+	if b.host != "" {
+		err := tracing.Run(ctx, "database.decr_host", func() error { return s.db.DecrHost(b.host) })
+		if err != nil {
+			s.log.Error("page stays counted on its host", "url", url.String(), "err", err)
+		}
+	}
+	if b.seed != "" {
+		err := tracing.Run(ctx, "database.decr_seed", func() error { return s.db.DecrSeed(b.seed) })
+		if err != nil {
+			s.log.Error("page stays counted on its seed", "url", url.String(), "err", err)
+		}
+	}
+}
+
+// booking is what count booked a page against.
+type booking struct {
+	host string
+	seed string
+}
+
+// count books a page against the per host limit and the budget of its seed
+// into b and reports whether both still allow it.
+func (s *service) count(
+	ctx context.Context,
+	url *gourl.URL,
+	seedUrl string,
+	b *booking,
+) (bool, error) {
+	sc, err := s.scope(ctx, seedUrl)
+	if err != nil || sc == nil {
+		return false, err
+	}
+	if sc.MaxPagesPerHost > 0 {
+		pages, err := tracing.Do(ctx, "database.incr_host", func() (int, error) {
+			return s.db.IncrHost(url.Hostname())
+		})
+		if err != nil {
+			return false, err
+		}
+		b.host = url.Hostname()
+		if pages > sc.MaxPagesPerHost {
+			return false, nil
+		}
+	}
+
+	sd, err := s.seed(ctx, seedUrl)
+	if err != nil {
+		return false, err
+	}
+	if sd != nil && sd.Budget > 0 {
+		pages, err := tracing.Do(ctx, "database.incr_seed", func() (int, error) {
+			return s.db.IncrSeed(seedUrl)
+		})
+		if err != nil {
+			return false, err
+		}
+		b.seed = seedUrl
+		if pages > sd.Budget {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// seed returns the stored seed behind url, nil for seeds that were never
+// added, like the ones queued before seeds were stored.
+func (s *service) seed(ctx context.Context, url string) (*seed.Seed, error) {
+	return s.seeds.get(url, func() (*seed.Seed, error) {
+		return tracing.Do(ctx, "database.seed", func() (*seed.Seed, error) {
+			return s.db.Seed(url)
+		})
+	})
+}
 
+// scope returns the scope links found from the seed at url are held against,
+// nil once the seed was removed.
+func (s *service) scope(ctx context.Context, url string) (*scope.Scope, error) {
+	sd, err := s.seed(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if sd != nil && sd.Removed {
+		return nil, nil
+	}
+	if sd != nil && sd.Scope != nil {
+		return sd.Scope, nil
+	}
+	return s.scopes.For(url), nil
+}
+
+// AddSeed stores sd and queues its url. A url that was visited before is only
+// queued again with force. It reports whether the url was queued.
+func (s *service) AddSeed(sd *seed.Seed, force bool) (bool, error) {
+	if err := sd.Validate(); err != nil {
+		return false, err
+	}
+	if err := s.db.SaveSeed(sd); err != nil {
+		return false, err
+	}
+	s.seeds.forget(sd.Url)
+
+	url, err := gourl.Parse(sd.Url)
+	if err != nil {
+		return false, err
+	}
+	msg := &message{Url: sd.Url, Seed: sd.Url}
+	return s.visit(context.Background(), url, msg, priority.Max, true, force)
+}
+
+// RemoveSeed stops following links found from the seed at url. Pages already
+// queued are still fetched, but nothing found on them is.
+func (s *service) RemoveSeed(url string) (bool, error) {
+	u, err := gourl.Parse(url)
+	if err != nil {
+		return false, err
+	}
+	removed, err := s.db.RemoveSeed(u.String())
+	s.seeds.forget(u.String())
+	return removed, err
+}
+
+func (s *service) Seeds() ([]*seed.Seed, error) {
+	return s.db.Seeds()
+}
+
+// push queues msg. While the queue is full it is spilled to the overflow
+// instead, the url is already marked visited and would be lost otherwise.
+func (s *service) push(ctx context.Context, msg *message, prio uint8, headers map[string]string) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	err = tracing.Run(ctx, "queue.push", func() error { return s.queue.Push(b, prio, headers) })
+	if !errors.Is(err, queue.ErrFull) {
+		return err
+	}
+	err = tracing.Run(ctx, "database.spill", func() error { return s.db.Spill(b, prio, headers) })
+	if err != nil {
+		return err
+	}
+	s.log.Debug("queue full, spilled", "url", msg.Url)
+	s.mu.Lock()
+	s.spilled = true
+	s.mu.Unlock()
+	return nil
+}
+
+// drainBatch is how many spilled messages are read at a time.
+const drainBatch = 100
+
+// drain moves spilled messages back onto the queue, the highest priority
+// first, until it is full again or the overflow is empty.
+func (s *service) drain() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.spilled {
+		spilled, err := s.db.Spilled(drainBatch)
+		if err != nil {
+			return err
+		}
+		for _, sp := range spilled {
+			err := s.queue.Push(sp.Msg, sp.Priority, sp.Headers)
+			if errors.Is(err, queue.ErrFull) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := s.db.Unspill(sp.Id); err != nil {
+				return err
+			}
+		}
+		s.spilled = len(spilled) == drainBatch
+	}
+	return nil
+}
+
+// Next blocks until a task is ready. It stays on the queue until it is acked
+// and is handed out again if the crawler dies before. Messages that can't be
+// read are dead-lettered with the reason. Every task taken makes room for a
+// spilled message to go back.
+func (s *service) Next() (*Task, error) {
+	for {
+		// the overflow keeps what failed to drain for the next time
+		if err := s.drain(); err != nil {
+			s.log.Warn("draining the overflow failed", "err", err)
+		}
+		d, err := s.queue.Pull()
+		if err != nil {
+			return nil, err
+		}
+		task, err := parseTask(d.Body(), d.Headers())
+		if err != nil {
+			s.log.Warn("dead-lettering malformed message", "body", string(d.Body()), "err", err)
+			if err := d.Reject("malformed message: " + err.Error()); err != nil {
+				s.log.Error("reject failed", "err", err)
+			}
+			continue
+		}
+		task.delivery = d
+		return task, nil
+	}
+}
+
+func parseTask(b []byte, headers map[string]string) (*Task, error) {
 	msg := &message{}
 	if err := json.Unmarshal(b, msg); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	url, err := gourl.Parse(msg.Url)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	// messages queued before seeds were tracked count as seeds
+	seed := url
+	if len(msg.Seed) > 0 {
+		seed, err = gourl.Parse(msg.Seed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var from *gourl.URL
+	if len(msg.From) > 0 {
+		from, err = gourl.Parse(msg.From)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	task := &Task{
+		Url:          url,
+		Alt:          msg.Alt,
+		Seed:         seed,
+		From:         from,
+		Depth:        msg.Depth,
+		ETag:         msg.ETag,
+		LastModified: msg.LastModified,
+	}
+	if headers[linkHeader] == "true" {
+		task.link = tracing.Extract(headers)
+	} else {
+		task.parent = tracing.Extract(headers)
+	}
+	return task, nil
+}
+
+// Trace starts the span of the work on the task, the spans of the data
+// service go below it from then on.
+func (t *Task) Trace(name string) trace.Span {
+	ctx := context.Background()
+	opts := []trace.SpanStartOption{}
+	if t.parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, t.parent)
+	}
+	if t.link.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: t.link}))
+	}
+	ctx, span := tracing.Start(ctx, name, opts...)
+	t.ctx = ctx
+	return span
+}
+
+// Context carries the span started by Trace.
+func (t *Task) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// Ack takes the task off the queue for good once it was processed.
+func (t *Task) Ack() error {
+	if t.delivery == nil {
+		return nil
+	}
+	return tracing.Run(t.Context(), "queue.ack", t.delivery.Ack)
+}
+
+// Nack gives the task back to the queue to be processed again, it is
+// dead-lettered without requeue or once it was retried too often.
+func (t *Task) Nack(requeue bool) error {
+	if t.delivery == nil {
+		return nil
+	}
+	return tracing.Run(t.Context(), "queue.nack", func() error {
+		return t.delivery.Nack(requeue)
+	})
+}
+
+// page returns the page of task as it was at its last fetch, a new one if it
+// was never fetched.
+func (s *service) page(task *Task) (*page.Page, error) {
+	hash, err := urlHash(task.Url)
+	if err != nil {
+		return nil, err
+	}
+	p, err := tracing.Do(task.Context(), "database.page", func() (*page.Page, error) {
+		return s.db.Page(hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = page.New(hash, task.Url.String())
+	}
+	return p, nil
+}
+
+// Changed reports whether the html page of task has a different body than at
+// its last fetch, without recording the fetch.
+func (s *service) Changed(task *Task, body []byte) (bool, error) {
+	p, err := s.page(task)
+	if err != nil {
+		return false, err
+	}
+	contentHash, err := domain.Sha256(body)
+	if err != nil {
+		return false, err
+	}
+	return contentHash != p.ContentHash, nil
+}
+
+// RecordFetch remembers a fetch of the html page of task and schedules its
+// next one. A nil body means the server answered not modified. It reports
+// whether the page changed since the last fetch, which it always did on the
+// first one. The crawler records a fetch once it is done with the page, a
+// page recorded as unchanged isn't visited again until it changes.
+func (s *service) RecordFetch(
+	task *Task,
+	etag, lastModified string,
+	body []byte,
+) (bool, error) {
+	p, err := s.page(task)
+	if err != nil {
+		return false, err
+	}
+	p.Seed = task.Seed.String()
+	p.Depth = task.Depth
+
+	changed := false
+	if body != nil {
+		contentHash, err := domain.Sha256(body)
+		if err != nil {
+			return false, err
+		}
+		changed = contentHash != p.ContentHash
+		p.ContentHash = contentHash
+	}
+	p.ETag = etag
+	p.LastModified = lastModified
+	p.Fetched(time.Now(), changed)
+
+	return changed, tracing.Run(task.Context(), "database.save_page", func() error {
+		return s.db.SavePage(p)
+	})
+}
+
+// FetchFailed backs off the next fetch of the page of task after its fetch
+// failed. Revisits are claimed past their lease otherwise, a page that is
+// gone would be fetched again every lease. Urls that were never fetched as a
+// page have no schedule to back off.
+func (s *service) FetchFailed(task *Task) error {
+	hash, err := urlHash(task.Url)
+	if err != nil {
+		return err
+	}
+	p, err := tracing.Do(task.Context(), "database.page", func() (*page.Page, error) {
+		return s.db.Page(hash)
+	})
+	if err != nil || p == nil {
+		return err
+	}
+	p.FetchFailed(time.Now())
+
+	return tracing.Run(task.Context(), "database.save_page", func() error {
+		return s.db.SavePage(p)
+	})
+}
+
+// Revisit pushes up to limit pages that are due for a fetch past the visited
+// set. They are leased for the given time, a page that got lost on the way
+// comes up again after that.
+func (s *service) Revisit(lease time.Duration, limit int) (int, error) {
+	pages, err := s.db.ClaimPages(time.Now(), lease, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, p := range pages {
+		url, err := gourl.Parse(p.Url)
+		if err != nil {
+			return i, err
+		}
+		yield, err := s.yield(context.Background(), url.Hostname())
+		if err != nil {
+			return i, err
+		}
+		err = s.push(context.Background(), &message{
+			Url:          p.Url,
+			Seed:         p.Seed,
+			Depth:        p.Depth,
+			ETag:         p.ETag,
+			LastModified: p.LastModified,
+		}, priority.Score(&priority.Signals{Depth: p.Depth, HostYield: yield}), nil)
+		if err != nil {
+			return i, err
+		}
 	}
 
-	return url, msg.Alt, nil
+	return len(pages), nil
 }
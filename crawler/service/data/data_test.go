@@ -0,0 +1,732 @@
+package data
+
+import (
+	"context"
+	"errors"
+	gourl "net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/memory"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/queue"
+	"github.com/kfc-manager/vision-seeker/crawler/domain"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/page"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/priority"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/scope"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/seed"
+)
+
+func TestStoreImage(t *testing.T) {
+	b, err := os.ReadFile("../../test/non-trans.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	img, err := image.Load(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	hash, err := domain.Sha256(img.Data)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	url, _ := gourl.Parse("https://example.com/a.png")
+
+	db := memory.NewDatabase()
+	buck := memory.NewBucket()
+	s := New(db, memory.NewCache(), buck, memory.NewQueue(0), nil, nil)
+
+	for i := 0; i < 2; i++ {
+		// storing an image again is fine
+		stored, err := s.StoreImage(context.Background(), img, url, "a label")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if stored != (i == 0) {
+			t.Errorf("got stored: %t, on attempt: %d", stored, i)
+		}
+	}
+
+	exist, err := db.ExistImage(hash)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !exist {
+		t.Error("image missing in database")
+	}
+	exist, err = buck.Exists(hash + ".png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !exist {
+		t.Error("image missing in bucket")
+	}
+	buck.List(stagingPrefix, func(key string) error {
+		t.Errorf("object left in staging: %s", key)
+		return nil
+	})
+}
+
+// brokenTx fails to begin the transaction of StoreImage.
+type brokenTx struct {
+	database.Database
+}
+
+func (db *brokenTx) Begin() (database.Tx, error) {
+	return nil, errors.New("database down")
+}
+
+func TestStoreImageFailed(t *testing.T) {
+	b, err := os.ReadFile("../../test/non-trans.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	img, err := image.Load(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	url, _ := gourl.Parse("https://example.com/a.png")
+
+	buck := memory.NewBucket()
+	s := New(&brokenTx{memory.NewDatabase()}, memory.NewCache(), buck, memory.NewQueue(0), nil, nil)
+	if _, err := s.StoreImage(context.Background(), img, url, "a label"); err == nil {
+		t.Fatal("image stored without a database")
+	}
+	buck.List("", func(key string) error {
+		t.Errorf("object left in the bucket: %s", key)
+		return nil
+	})
+}
+
+func TestRecover(t *testing.T) {
+	b, err := os.ReadFile("../../test/non-trans.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	img, err := image.Load(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	hash, err := domain.Sha256(img.Data)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	db := memory.NewDatabase()
+	buck := memory.NewBucket()
+	s := New(db, memory.NewCache(), buck, memory.NewQueue(0), nil, nil)
+
+	// a crash after the commit and one before it
+	if _, err := db.InsertImage(database.NewImageInfo(hash, "", img)); err != nil {
+		t.Fatal(err.Error())
+	}
+	buck.Put(stagingPrefix+hash+".png", img.Data)
+	buck.Put(stagingPrefix+"uncommitted.png", []byte("x"))
+
+	if err := s.Recover(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	exist, err := buck.Exists(hash + ".png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !exist {
+		t.Error("committed image was not published")
+	}
+	exist, err = buck.Exists("uncommitted.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if exist {
+		t.Error("uncommitted image was published")
+	}
+	buck.List(stagingPrefix, func(key string) error {
+		t.Errorf("object left in staging: %s", key)
+		return nil
+	})
+}
+
+func TestVisit(t *testing.T) {
+	cach := memory.NewCache()
+	s := New(memory.NewDatabase(), cach, memory.NewBucket(), memory.NewQueue(0), nil, nil)
+
+	input := []string{
+		"https://example.com/a",
+		"https://example.com/b?page=2",
+		"https://example.com/a",
+		"http://example.com/a",
+		"https://example.com/cached",
+	}
+	hash, err := domain.Sha256([]byte("example.com/cached"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := cach.Set(hash); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	seed, _ := gourl.Parse("https://example.com/")
+	from := &Task{Url: seed, Seed: seed}
+	for _, v := range input {
+		url, _ := gourl.Parse(v)
+		if err := s.VisitImage(from, url, "alt of "+v, 0); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	// seeds go first
+	end, _ := gourl.Parse("https://example.com/end")
+	if err := s.Visit(nil, end, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+	task, err := s.Next()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// a seed is its own seed
+	if task.Url.String() != end.String() || task.Seed.String() != end.String() || task.Depth != 0 {
+		t.Errorf("unexpected task: %+v, want: %s", task, end.String())
+	}
+
+	// the marker, duplicates and cached urls never reach the queue
+	marker, _ := gourl.Parse("https://example.com/marker.png")
+	if err := s.VisitImage(from, marker, "alt of "+marker.String(), 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, want := range []string{
+		"https://example.com/a",
+		"https://example.com/b?page=2",
+		marker.String(),
+	} {
+		task, err := s.Next()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if task.Url.String() != want || task.Alt != "alt of "+want ||
+			task.Seed.String() != seed.String() || task.From.String() != seed.String() ||
+			task.Depth != 1 {
+			t.Errorf("unexpected task: %+v, want: %s", task, want)
+		}
+	}
+
+	// visited urls are written through to the cache
+	hash, err = domain.Sha256([]byte("example.com/a"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	exist, err := cach.Exist(hash)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !exist {
+		t.Error("visited url not cached")
+	}
+}
+
+// brokenPush fails the first push.
+type brokenPush struct {
+	queue.Queue
+	failed bool
+}
+
+func (q *brokenPush) Push(msg []byte, priority uint8, headers map[string]string) error {
+	if !q.failed {
+		q.failed = true
+		return errors.New("queue down")
+	}
+	return q.Queue.Push(msg, priority, headers)
+}
+
+func TestVisitFailed(t *testing.T) {
+	que := memory.NewQueue(0)
+	s := New(memory.NewDatabase(), memory.NewCache(), memory.NewBucket(), &brokenPush{Queue: que}, nil, nil)
+
+	seed, _ := gourl.Parse("https://example.com/")
+	from := &Task{Url: seed, Seed: seed}
+	url, _ := gourl.Parse("https://example.com/a.png")
+	if err := s.VisitImage(from, url, "", 0); err == nil {
+		t.Fatal("visit succeeded without a queue")
+	}
+	// the url wasn't queued, so it isn't visited either
+	if err := s.VisitImage(from, url, "", 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n, err := que.Len(); err != nil || n != 1 {
+		t.Fatalf("got %d queued: %v, want: 1", n, err)
+	}
+}
+
+func TestVisitFailedLimits(t *testing.T) {
+	que := memory.NewQueue(0)
+	broken := &brokenPush{Queue: que, failed: true}
+	s := New(memory.NewDatabase(), memory.NewCache(), memory.NewBucket(), broken, nil, nil)
+
+	// the seed takes the first page of both limits
+	sd := &seed.Seed{
+		Url:    "https://example.com/",
+		Scope:  &scope.Scope{MaxPagesPerHost: 3},
+		Budget: 3,
+	}
+	if _, err := s.AddSeed(sd, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	broken.failed = false
+
+	seed, _ := gourl.Parse(sd.Url)
+	from := &Task{Url: seed, Seed: seed}
+	a, _ := gourl.Parse("https://example.com/a")
+	if err := s.Visit(from, a, ""); err == nil {
+		t.Fatal("visit succeeded without a queue")
+	}
+	// the failed push took back its page, both still fit
+	b, _ := gourl.Parse("https://example.com/b")
+	for _, url := range []*gourl.URL{a, b} {
+		if err := s.Visit(from, url, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if n, err := que.Len(); err != nil || n != 3 {
+		t.Fatalf("got %d queued: %v, want: 3", n, err)
+	}
+}
+
+func TestRevisit(t *testing.T) {
+	db := memory.NewDatabase()
+	s := New(db, memory.NewCache(), memory.NewBucket(), memory.NewQueue(0), nil, nil)
+	url, _ := gourl.Parse("https://example.com/gallery")
+	seed, _ := gourl.Parse("https://example.com/")
+	fetched := &Task{Url: url, Seed: seed, Depth: 3}
+
+	for i, body := range []string{"a", "a", "b"} {
+		// asking doesn't record anything
+		for j := 0; j < 2; j++ {
+			changed, err := s.Changed(fetched, []byte(body))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if want := i != 1; changed != want {
+				t.Errorf("got changed before recording: %t, want: %t, on fetch: %d", changed, want, i)
+			}
+		}
+		changed, err := s.RecordFetch(fetched, `"etag"`, "", []byte(body))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if want := i != 1; changed != want {
+			t.Errorf("got changed: %t, want: %t, on fetch: %d", changed, want, i)
+		}
+	}
+	changed, err := s.RecordFetch(fetched, `"etag"`, "", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if changed {
+		t.Error("not modified page changed")
+	}
+
+	// nothing is due right after a fetch
+	n, err := s.Revisit(time.Hour, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n != 0 {
+		t.Errorf("got %d revisits, want: 0", n)
+	}
+
+	hash, err := domain.Sha256([]byte("example.com/gallery"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	p, err := db.Page(hash)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if p.Fetches != 4 || p.Changes != 2 {
+		t.Errorf("got fetches: %d, changes: %d", p.Fetches, p.Changes)
+	}
+	p.NextFetch = time.Now().Add(-time.Minute)
+	if err := db.SavePage(p); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	n, err = s.Revisit(time.Hour, 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n != 1 {
+		t.Errorf("got %d revisits, want: 1", n)
+	}
+	task, err := s.Next()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if task.Url.String() != url.String() || task.ETag != `"etag"` ||
+		task.Seed.String() != seed.String() || task.Depth != 3 {
+		t.Errorf("unexpected task: %+v", task)
+	}
+
+	// a revisit that failed to fetch backs off past the lease
+	for i := 0; i < 2; i++ {
+		if err := s.FetchFailed(task); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	p, err = db.Page(hash)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if p.Failures != 2 || p.NextFetch.Before(time.Now().Add(2*page.MinInterval-time.Minute)) {
+		t.Errorf("got failures: %d, next fetch: %v", p.Failures, p.NextFetch)
+	}
+
+	// a url that was never fetched as a page has nothing to back off
+	other, _ := gourl.Parse("https://example.com/missing")
+	if err := s.FetchFailed(&Task{Url: other, Seed: seed}); err != nil {
+		t.Fatal(err.Error())
+	}
+	hash, err = domain.Sha256([]byte("example.com/missing"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if p, err := db.Page(hash); err != nil || p != nil {
+		t.Errorf("got page: %+v, err: %v", p, err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	s := &scope.Scope{Mode: scope.Host, MaxDepth: 2, MaxPagesPerHost: 3}
+	if err := s.Compile(); err != nil {
+		t.Fatal(err.Error())
+	}
+	que := memory.NewQueue(0)
+	serv := New(
+		memory.NewDatabase(),
+		memory.NewCache(),
+		memory.NewBucket(),
+		que,
+		&scope.Config{Default: s},
+		nil,
+	)
+
+	seed, _ := gourl.Parse("https://example.com/")
+	if err := serv.Visit(nil, seed, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+	from := &Task{Url: seed, Seed: seed, Depth: 1}
+	for _, v := range []string{
+		"https://example.com/a",
+		"https://other.com/a",
+		"https://example.com/b",
+		"https://example.com/c",
+	} {
+		url, _ := gourl.Parse(v)
+		if err := serv.Visit(from, url, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	// images don't count as pages and may live elsewhere
+	img, _ := gourl.Parse("https://cdn.other.com/a.png")
+	if err := serv.VisitImage(from, img, "", 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	// too deep
+	deep, _ := gourl.Parse("https://example.com/deep")
+	if err := serv.Visit(&Task{Url: seed, Seed: seed, Depth: 2}, deep, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+	end, _ := gourl.Parse("https://end.com/")
+	if err := serv.Visit(nil, end, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// seeds first, then images before pages
+	for _, want := range []string{
+		"https://example.com/",
+		"https://end.com/",
+		"https://cdn.other.com/a.png",
+		"https://example.com/a",
+		"https://example.com/b",
+	} {
+		task, err := serv.Next()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if task.Url.String() != want {
+			t.Errorf("got url: %s, want: %s", task.Url.String(), want)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	s := New(memory.NewDatabase(), memory.NewCache(), memory.NewBucket(), memory.NewQueue(0), nil, nil)
+
+	budgeted := &seed.Seed{Url: "https://example.com/", Budget: 2}
+	scoped := &seed.Seed{
+		Url:   "https://other.com/",
+		Scope: &scope.Scope{Mode: scope.Host, ExcludePaths: []string{"^/private"}},
+	}
+	for _, sd := range []*seed.Seed{budgeted, scoped} {
+		queued, err := s.AddSeed(sd, false)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !queued {
+			t.Errorf("new seed %s not queued", sd.Url)
+		}
+	}
+	// a visited seed only comes back with force
+	for _, force := range []bool{false, true} {
+		queued, err := s.AddSeed(budgeted, force)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if queued != force {
+			t.Errorf("got queued: %t, with force: %t", queued, force)
+		}
+	}
+
+	seeds, err := s.Seeds()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(seeds) != 2 || seeds[0].Url != budgeted.Url || seeds[1].Url != scoped.Url {
+		t.Errorf("unexpected seeds: %+v", seeds)
+	}
+
+	example, _ := gourl.Parse(budgeted.Url)
+	other, _ := gourl.Parse(scoped.Url)
+	fromExample := &Task{Url: example, Seed: example}
+	fromOther := &Task{Url: other, Seed: other}
+	visits := []struct {
+		from *Task
+		url  string
+	}{
+		// the seed itself spent the first page of the budget, forcing it
+		// again didn't
+		{fromExample, "https://example.com/a"},
+		{fromExample, "https://example.com/b"},
+		// its own scope, not the default that allows everything
+		{fromOther, "https://other.com/private/a"},
+		{fromOther, "https://example.com/c"},
+		{fromOther, "https://other.com/a"},
+	}
+	for _, v := range visits {
+		url, _ := gourl.Parse(v.url)
+		if err := s.Visit(v.from, url, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	removed, err := s.RemoveSeed(scoped.Url)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !removed {
+		t.Error("seed not removed")
+	}
+	// nothing found from a removed seed is followed
+	after, _ := gourl.Parse("https://other.com/after")
+	if err := s.Visit(fromOther, after, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, want := range []string{
+		"https://example.com/",
+		"https://other.com/",
+		"https://example.com/",
+		"https://example.com/a",
+		"https://other.com/a",
+	} {
+		task, err := s.Next()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if task.Url.String() != want {
+			t.Errorf("got url: %s, want: %s", task.Url.String(), want)
+		}
+	}
+	end, _ := gourl.Parse("https://end.com/")
+	if err := s.Visit(nil, end, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+	task, err := s.Next()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if task.Url.String() != end.String() {
+		t.Errorf("got url: %s, want: %s", task.Url.String(), end.String())
+	}
+}
+
+func TestPriority(t *testing.T) {
+	s := New(memory.NewDatabase(), memory.NewCache(), memory.NewBucket(), memory.NewQueue(0), nil, nil)
+	seedUrl, _ := gourl.Parse("https://example.com/")
+	good, _ := gourl.Parse("https://good.com/gallery")
+	other, _ := gourl.Parse("https://other.com/")
+	from := &Task{Url: seedUrl, Seed: seedUrl}
+
+	// an image from a page on good.com was kept before
+	img, _ := gourl.Parse("https://cdn.com/kept.png")
+	if err := s.Accepted(&Task{Url: img, Seed: seedUrl, From: good}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	visits := []struct {
+		url    string
+		anchor string
+	}{
+		{"https://other.com/login", "Log in"},
+		{"https://other.com/a", "Next"},
+		{"https://good.com/a", "Next"},
+		{"https://other.com/photos", "Photo gallery"},
+	}
+	for _, v := range visits {
+		url, _ := gourl.Parse(v.url)
+		if err := s.Visit(from, url, v.anchor); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	for _, v := range []struct {
+		url   string
+		width int
+	}{
+		{"https://other.com/small.png", 100},
+		{"https://other.com/large.png", 2048},
+	} {
+		url, _ := gourl.Parse(v.url)
+		if err := s.VisitImage(&Task{Url: other, Seed: seedUrl}, url, "", v.width); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	for _, want := range []string{
+		"https://other.com/large.png",
+		"https://other.com/photos",
+		"https://good.com/a",
+		"https://other.com/a",
+		"https://other.com/small.png",
+		"https://other.com/login",
+	} {
+		task, err := s.Next()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if task.Url.String() != want {
+			t.Errorf("got url: %s, want: %s", task.Url.String(), want)
+		}
+	}
+}
+
+func TestAck(t *testing.T) {
+	que := memory.NewQueue(0)
+	s := New(memory.NewDatabase(), memory.NewCache(), memory.NewBucket(), que, nil, nil)
+
+	// unreadable messages are dead-lettered on the way
+	if err := que.Push([]byte("not json"), priority.Max, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	url, _ := gourl.Parse("https://example.com/")
+	if err := s.Visit(nil, url, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+	task, err := s.Next()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if task.Url.String() != url.String() {
+		t.Errorf("got url: %s, want: %s", task.Url.String(), url.String())
+	}
+
+	// a task given back comes again
+	if err := task.Nack(true); err != nil {
+		t.Fatal(err.Error())
+	}
+	task, err = s.Next()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if task.Url.String() != url.String() {
+		t.Errorf("got url: %s, want: %s", task.Url.String(), url.String())
+	}
+	if err := task.Ack(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := task.Ack(); err == nil {
+		t.Error("task acked twice")
+	}
+
+	letters, err := que.DeadLetters(0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(letters) != 1 || string(letters[0].Body) != "not json" ||
+		!strings.HasPrefix(letters[0].Reason, "malformed message") {
+		t.Errorf("unexpected dead letters: %+v", letters)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	db := memory.NewDatabase()
+	s := New(db, memory.NewCache(), memory.NewBucket(), memory.NewQueue(1), nil, nil)
+
+	input := []string{
+		"https://example.com/",
+		"https://example.org/",
+		"https://example.net/",
+	}
+	for _, v := range input {
+		url, _ := gourl.Parse(v)
+		if err := s.Visit(nil, url, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	spilled, err := db.Spilled(10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(spilled) != 2 {
+		t.Errorf("got spilled: %d, want: 2", len(spilled))
+	}
+
+	// every task taken makes room for the next one spilled
+	for _, want := range input {
+		task, err := s.Next()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if task.Url.String() != want {
+			t.Errorf("got url: %s, want: %s", task.Url.String(), want)
+		}
+		if err := task.Ack(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	spilled, err = db.Spilled(10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(spilled) != 0 {
+		t.Errorf("got spilled: %d, want: 0", len(spilled))
+	}
+}
+
+func TestTTLCacheSweep(t *testing.T) {
+	c := newTTLCache[int](10 * time.Millisecond)
+	load := func() (int, error) { return 1, nil }
+	for _, key := range []string{"a.com", "b.com", "c.com"} {
+		if _, err := c.get(key, load); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	// hosts that are never asked for again go with the next load
+	if _, err := c.get("d.com", load); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("got entries: %d, want: 1", len(c.entries))
+	}
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache remembers what was loaded for a key for a while, so changes made
+// by another process take effect here after at most ttl. Expired entries are
+// swept out every ttl, keys that are never asked for again don't pile up.
+type ttlCache[V any] struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*entry[V]
+	swept   time.Time
+}
+
+type entry[V any] struct {
+	val    V
+	loaded time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{ttl: ttl, entries: map[string]*entry[V]{}, swept: time.Now()}
+}
+
+// get returns the value of key, calling load if it isn't known or too old.
+func (c *ttlCache[V]) get(key string, load func() (V, error)) (V, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Since(e.loaded) < c.ttl {
+		return e.val, nil
+	}
+
+	val, err := load()
+	if err != nil {
+		return val, err
+	}
+	now := time.Now()
+	c.mu.Lock()
+	c.entries[key] = &entry[V]{val: val, loaded: now}
+	if now.Sub(c.swept) >= c.ttl {
+		for k, e := range c.entries {
+			if now.Sub(e.loaded) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	c.mu.Unlock()
+	return val, nil
+}
+
+func (c *ttlCache[V]) forget(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
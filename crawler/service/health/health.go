@@ -0,0 +1,121 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check returns why something isn't well, nil if it is.
+type Check func() error
+
+type Service interface {
+	// Live adds a check for /healthz, a failing one means the process should
+	// be restarted.
+	Live(name string, check Check)
+	// Ready adds a check for /readyz, a failing one means a dependency is
+	// unavailable for now.
+	Ready(name string, check Check)
+	Healthz(w http.ResponseWriter, r *http.Request)
+	Readyz(w http.ResponseWriter, r *http.Request)
+}
+
+type named struct {
+	name  string
+	check Check
+}
+
+type service struct {
+	mu    sync.Mutex
+	live  []named
+	ready []named
+}
+
+func New() *service {
+	return &service{}
+}
+
+func (s *service) Live(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live = append(s.live, named{name: name, check: check})
+}
+
+func (s *service) Ready(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = append(s.ready, named{name: name, check: check})
+}
+
+func (s *service) Healthz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	checks := s.live
+	s.mu.Unlock()
+	respond(w, checks)
+}
+
+func (s *service) Readyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	checks := s.ready
+	s.mu.Unlock()
+	respond(w, checks)
+}
+
+// respond runs the checks concurrently and answers 503 if any failed, with
+// the outcome of each.
+func respond(w http.ResponseWriter, checks []named) {
+	results := make(map[string]string, len(checks))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c named) {
+			defer wg.Done()
+			result := "ok"
+			if err := c.check(); err != nil {
+				result = err.Error()
+			}
+			mu.Lock()
+			results[c.name] = result
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+// Wait calls fn until it succeeds, backing off in between, and gives up after
+// timeout with the last error.
+func Wait(name string, timeout time.Duration, fn func() error) error {
+	deadline := time.Now().Add(timeout)
+	backoff := minBackoff
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("%s not ready after %s: %w", name, timeout, err)
+		}
+		slog.Info("waiting for dependency", "name", name, "backoff", backoff, "err", err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, handler http.HandlerFunc) (int, map[string]string) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/", nil))
+	results := map[string]string{}
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatal(err.Error())
+	}
+	return rec.Code, results
+}
+
+func TestChecks(t *testing.T) {
+	s := New()
+	var down error
+	s.Live("loop", func() error { return nil })
+	s.Ready("database", func() error { return nil })
+	s.Ready("queue", func() error { return down })
+
+	status, results := get(t, s.Readyz)
+	if status != http.StatusOK || results["database"] != "ok" || results["queue"] != "ok" {
+		t.Errorf("got status: %d, results: %v", status, results)
+	}
+
+	down = errors.New("not connected")
+	status, results = get(t, s.Readyz)
+	if status != http.StatusServiceUnavailable || results["queue"] != "not connected" {
+		t.Errorf("got status: %d, results: %v", status, results)
+	}
+	// readiness doesn't touch liveness
+	status, results = get(t, s.Healthz)
+	if status != http.StatusOK || len(results) != 1 || results["loop"] != "ok" {
+		t.Errorf("got status: %d, results: %v", status, results)
+	}
+}
+
+func TestWait(t *testing.T) {
+	tries := 0
+	err := Wait("flaky", time.Minute, func() error {
+		tries++
+		if tries < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err != nil || tries != 3 {
+		t.Errorf("got error: %v, after tries: %d", err, tries)
+	}
+
+	err = Wait("down", 250*time.Millisecond, func() error { return errors.New("refused") })
+	if err == nil {
+		t.Error("no error for a dependency that never came up")
+	}
+}
@@ -0,0 +1,288 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/client"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain"
+	"github.com/kfc-manager/vision-seeker/crawler/domain/image"
+)
+
+type Service interface {
+	MigrateLayout() (*MigrateReport, error)
+	Verify(opts *VerifyOptions) (*VerifyReport, error)
+}
+
+type MigrateReport struct {
+	Migrated int               `json:"migrated"`
+	Sharded  int               `json:"sharded"`
+	Skipped  []string          `json:"skipped"`
+	Failed   map[string]string `json:"failed"`
+}
+
+type VerifyOptions struct {
+	Rehash  bool // read every object and compare it against its hash
+	Refetch bool // download missing and corrupt images again from their url
+	Delete  bool // delete whatever is orphaned or can't be repaired
+}
+
+type VerifyReport struct {
+	Images    int               `json:"images"`
+	Objects   int               `json:"objects"`
+	Missing   []string          `json:"missing"`
+	Corrupt   []string          `json:"corrupt"`
+	Unlabeled []string          `json:"unlabeled"`
+	Orphans   []string          `json:"orphans"`
+	Refetched []string          `json:"refetched"`
+	Deleted   []string          `json:"deleted"`
+	Failed    map[string]string `json:"failed"`
+}
+
+type service struct {
+	db     database.Database
+	bucket bucket.Bucket
+	client client.Client
+}
+
+// New expects the raw bucket, not the sharded view on top of it, since it
+// has to see and move objects of both layouts. The database and client are
+// only used by Verify and may be nil for MigrateLayout.
+func New(db database.Database, b bucket.Bucket, c client.Client) *service {
+	return &service{db: db, bucket: b, client: c}
+}
+
+func isHash(key string) bool {
+	_, err := hex.DecodeString(key)
+	return len(key) == 64 && err == nil
+}
+
+// MigrateLayout moves every object of the flat layout to its sharded key.
+// It can be interrupted and rerun at any time, objects already copied are
+// only deleted from their flat key.
+func (s *service) MigrateLayout() (*MigrateReport, error) {
+	report := &MigrateReport{Skipped: []string{}, Failed: map[string]string{}}
+
+	// collect first, a local bucket walk could otherwise run into the
+	// objects we write while walking
+	flat := []string{}
+	err := s.bucket.List("", func(key string) error {
+		if strings.Contains(key, "/") {
+			report.Sharded++
+			return nil
+		}
+		if !isHash(key) {
+			report.Skipped = append(report.Skipped, key)
+			return nil
+		}
+		flat = append(flat, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range flat {
+		if err := s.migrate(key); err != nil {
+			report.Failed[key] = err.Error()
+			continue
+		}
+		report.Migrated++
+	}
+
+	return report, nil
+}
+
+func (s *service) migrate(key string) error {
+	body, err := s.bucket.Get(key)
+	if err != nil {
+		return err
+	}
+	form, err := image.Format(body)
+	if err != nil {
+		return err
+	}
+
+	dst := bucket.ShardKey(key + "." + form)
+	info, err := s.bucket.Stat(dst)
+	if err != nil && err != bucket.ErrNotFound {
+		return err
+	}
+	if err == bucket.ErrNotFound || info.Size != int64(len(body)) {
+		if err := s.bucket.Put(dst, body); err != nil {
+			return err
+		}
+	}
+
+	return s.bucket.Delete(key)
+}
+
+// Verify cross checks the image table against the bucket. It is meant to
+// run while no crawler is writing, otherwise images stored during the walk
+// can show up as orphans.
+func (s *service) Verify(opts *VerifyOptions) (*VerifyReport, error) {
+	report := &VerifyReport{
+		Missing:   []string{},
+		Corrupt:   []string{},
+		Unlabeled: []string{},
+		Orphans:   []string{},
+		Refetched: []string{},
+		Deleted:   []string{},
+		Failed:    map[string]string{},
+	}
+	buck := bucket.NewSharded(s.bucket)
+
+	// collect problems first and repair afterwards, refetching could take
+	// a long time and we don't want to hold the cursor open meanwhile
+	known := map[string]bool{}
+	broken := []*database.ImageRecord{}
+	unlabeled := []*database.ImageRecord{}
+	err := s.db.Images(func(rec *database.ImageRecord) error {
+		report.Images++
+		known[rec.Hash] = true
+
+		ok, err := s.check(buck, rec, opts.Rehash)
+		if err == bucket.ErrNotFound {
+			report.Missing = append(report.Missing, rec.Hash)
+			broken = append(broken, rec)
+			return nil
+		}
+		if err != nil {
+			report.Failed[rec.Hash] = err.Error()
+			return nil
+		}
+		if !ok {
+			report.Corrupt = append(report.Corrupt, rec.Hash)
+			broken = append(broken, rec)
+			return nil
+		}
+		if !rec.Labeled {
+			report.Unlabeled = append(report.Unlabeled, rec.Hash)
+			unlabeled = append(unlabeled, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := []string{}
+	err = buck.List("", func(key string) error {
+		// staging and other prefixed keys aren't images
+		if strings.Contains(key, "/") {
+			return nil
+		}
+		report.Objects++
+		if !known[bucket.FlatKey(key)] {
+			report.Orphans = append(report.Orphans, key)
+			orphans = append(orphans, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rec := range broken {
+		if opts.Refetch {
+			err := s.refetch(buck, rec)
+			if err == nil {
+				report.Refetched = append(report.Refetched, rec.Hash)
+				continue
+			}
+			report.Failed[rec.Hash] = err.Error()
+		}
+		if opts.Delete {
+			s.deleteImage(buck, rec, report)
+		}
+	}
+
+	if opts.Delete {
+		for _, rec := range unlabeled {
+			s.deleteImage(buck, rec, report)
+		}
+		for _, key := range orphans {
+			if err := buck.Delete(key); err != nil {
+				report.Failed[key] = err.Error()
+				continue
+			}
+			report.Deleted = append(report.Deleted, key)
+		}
+	}
+
+	return report, nil
+}
+
+func (s *service) check(buck bucket.Bucket, rec *database.ImageRecord, rehash bool) (bool, error) {
+	key := rec.Hash + "." + rec.Format
+	if !rehash {
+		exist, err := buck.Exists(key)
+		if err != nil {
+			return false, err
+		}
+		if !exist {
+			return false, bucket.ErrNotFound
+		}
+		return true, nil
+	}
+
+	body, err := buck.Get(key)
+	if err != nil {
+		return false, err
+	}
+	hash, err := domain.Sha256(body)
+	if err != nil {
+		return false, err
+	}
+	return hash == rec.Hash, nil
+}
+
+func (s *service) refetch(buck bucket.Bucket, rec *database.ImageRecord) error {
+	if len(rec.Url) < 1 {
+		return errors.New("no url to refetch from")
+	}
+	res, err := s.client.Get(context.Background(), rec.Url)
+	if err != nil {
+		return err
+	}
+	body := res.Body
+	hash, err := domain.Sha256(body)
+	if err != nil {
+		return err
+	}
+	if hash != rec.Hash {
+		// the crawler might have stored an sRGB converted copy
+		img, err := image.Load(body)
+		if err != nil {
+			return err
+		}
+		if err := img.ToSRGB(); err != nil {
+			return err
+		}
+		body = img.Data
+		hash, err = domain.Sha256(body)
+		if err != nil {
+			return err
+		}
+	}
+	if hash != rec.Hash {
+		return errors.New("image at url has changed")
+	}
+	return buck.Put(rec.Hash+"."+rec.Format, body)
+}
+
+func (s *service) deleteImage(buck bucket.Bucket, rec *database.ImageRecord, report *VerifyReport) {
+	if err := s.db.DeleteImage(rec.Hash); err != nil {
+		report.Failed[rec.Hash] = err.Error()
+		return
+	}
+	if err := buck.Delete(rec.Hash + "." + rec.Format); err != nil {
+		report.Failed[rec.Hash] = err.Error()
+		return
+	}
+	report.Deleted = append(report.Deleted, rec.Hash)
+}
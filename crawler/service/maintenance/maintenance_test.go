@@ -0,0 +1,157 @@
+package maintenance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/bucket"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/client"
+	"github.com/kfc-manager/vision-seeker/crawler/adapter/database"
+	"github.com/kfc-manager/vision-seeker/crawler/domain"
+)
+
+func TestMigrateLayout(t *testing.T) {
+	b, err := bucket.NewLocal(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	img, err := os.ReadFile("../../test/non-trans.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	hash, err := domain.Sha256(img)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := b.Put(hash, img); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := b.Put("notes.txt", []byte("not an image")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s := New(nil, b, nil)
+	report, err := s.MigrateLayout()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if report.Migrated != 1 || len(report.Skipped) != 1 || len(report.Failed) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	got, err := bucket.NewSharded(b).Get(hash + ".png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(got) != len(img) {
+		t.Errorf("got size: %d, want: %d", len(got), len(img))
+	}
+	if exist, _ := b.Exists(hash); exist {
+		t.Error("flat object was not removed")
+	}
+
+	// a second run finds nothing left to do
+	report, err = s.MigrateLayout()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if report.Migrated != 0 || report.Sharded != 1 {
+		t.Errorf("unexpected report on rerun: %+v", report)
+	}
+}
+
+type fakeDatabase struct {
+	database.Database
+	images map[string]*database.ImageRecord
+}
+
+func (db *fakeDatabase) Images(fn func(rec *database.ImageRecord) error) error {
+	for _, rec := range db.images {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *fakeDatabase) DeleteImage(hash string) error {
+	delete(db.images, hash)
+	return nil
+}
+
+func TestVerify(t *testing.T) {
+	raw, err := bucket.NewLocal(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b := bucket.NewSharded(raw)
+
+	img, err := os.ReadFile("../../test/non-trans.png")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(img)
+	}))
+	defer srv.Close()
+
+	hash, err := domain.Sha256(img)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fine := strings.Repeat("a", 64)
+	corrupt := strings.Repeat("b", 64)
+	unlabeled := strings.Repeat("c", 64)
+	orphan := strings.Repeat("d", 64) + ".png"
+	db := &fakeDatabase{images: map[string]*database.ImageRecord{
+		// missing from the bucket, but can be fetched again
+		hash:      {Hash: hash, Format: "png", Url: srv.URL, Labeled: true},
+		fine:      {Hash: fine, Format: "png", Labeled: true},
+		corrupt:   {Hash: corrupt, Format: "png", Labeled: true},
+		unlabeled: {Hash: unlabeled, Format: "png"},
+	}}
+	for _, key := range []string{fine + ".png", corrupt + ".png", unlabeled + ".png", orphan} {
+		if err := b.Put(key, []byte(key)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	// without rehashing only missing objects stand out
+	s := New(db, raw, client.New())
+	report, err := s.Verify(&VerifyOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(report.Missing) != 1 || len(report.Corrupt) != 0 || len(report.Orphans) != 1 ||
+		len(report.Unlabeled) != 1 || len(report.Deleted) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	report, err = s.Verify(&VerifyOptions{Rehash: true, Refetch: true, Delete: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(report.Refetched) != 1 || report.Refetched[0] != hash {
+		t.Errorf("unexpected refetched: %v", report.Refetched)
+	}
+	// fine has the wrong content as well, since its body isn't its hash
+	if len(report.Corrupt) != 3 || len(report.Deleted) != 4 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if _, ok := db.images[hash]; !ok || len(db.images) != 1 {
+		t.Errorf("unexpected images left: %v", db.images)
+	}
+
+	report, err = s.Verify(&VerifyOptions{Rehash: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if report.Images != 1 || report.Objects != 1 || len(report.Failed) != 0 {
+		t.Errorf("bucket not consistent after repair: %+v", report)
+	}
+}
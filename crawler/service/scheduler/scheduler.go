@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/kfc-manager/vision-seeker/crawler/service/data"
+)
+
+type Service interface {
+	Run()
+}
+
+type service struct {
+	data  data.Service
+	every time.Duration
+	lease time.Duration
+	limit int
+	log   *slog.Logger
+}
+
+// New returns a scheduler that looks for pages due for a recrawl every so
+// often and queues up to limit of them at once. The lease should outlast the
+// time a url waits in the queue, otherwise a page is queued again before the
+// crawler got to it. A nil logger logs to the default one.
+func New(d data.Service, every, lease time.Duration, limit int, log *slog.Logger) *service {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &service{data: d, every: every, lease: lease, limit: limit, log: log}
+}
+
+func (s *service) Run() {
+	for {
+		n, err := s.data.Revisit(s.lease, s.limit)
+		if err != nil {
+			s.log.Warn("queueing revisits failed", "queued", n, "err", err)
+		} else if n > 0 {
+			s.log.Debug("queued revisits", "queued", n)
+		}
+		// a full batch means there is probably more due right away
+		if err == nil && n >= s.limit {
+			continue
+		}
+		time.Sleep(s.every)
+	}
+}
@@ -17,13 +17,22 @@ db_conn = psycopg2.connect(
 )
 
 cursor = db_conn.cursor()
-cursor.execute("SELECT hash FROM image WHERE clip_embedding IS NULL;")
-rows = cursor.fetchall()
-result = [row[0] for row in rows]
+cursor.execute("SELECT hash, format FROM image WHERE clip_embedding IS NULL;")
+result = cursor.fetchall()
 cursor.close()
 
-for hash in result:
-    with open(os.getenv("BUCKET_PATH")+"/"+hash, "rb") as f:
+
+def image_path(hash, format):
+    # sharded layout first, flat layout for buckets not migrated yet
+    bucket = os.getenv("BUCKET_PATH")
+    path = f"{bucket}/{hash[:2]}/{hash[2:4]}/{hash}.{format}"
+    if os.path.exists(path):
+        return path
+    return f"{bucket}/{hash}"
+
+
+for hash, format in result:
+    with open(image_path(hash, format), "rb") as f:
         image = preprocess(
             Image.open(BytesIO(f.read()))
         ).unsqueeze(0).to(device)